@@ -0,0 +1,724 @@
+package fsutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	dsnetbzip2 "github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ArchiveFormat identifies an archive container and its compression.
+type ArchiveFormat int
+
+const (
+	// FormatUnknown is used to request format detection.
+	FormatUnknown ArchiveFormat = iota
+	FormatZip
+	FormatTar
+	FormatTarGzip
+	FormatTarBzip2
+	FormatTarZstd
+)
+
+func (f ArchiveFormat) String() string {
+	switch f {
+	case FormatZip:
+		return "zip"
+	case FormatTar:
+		return "tar"
+	case FormatTarGzip:
+		return "tar.gz"
+	case FormatTarBzip2:
+		return "tar.bz2"
+	case FormatTarZstd:
+		return "tar.zst"
+	default:
+		return "unknown"
+	}
+}
+
+// ArchiveFormatFromName returns the archive format matching the extension of
+// name, or FormatUnknown if the extension is not recognized.
+func ArchiveFormatFromName(name string) ArchiveFormat {
+	name = strings.ToLower(name)
+	for _, s := range []struct {
+		ext    string
+		format ArchiveFormat
+	}{
+		{".zip", FormatZip},
+		{".tar", FormatTar},
+		{".tar.gz", FormatTarGzip},
+		{".tgz", FormatTarGzip},
+		{".tar.bz2", FormatTarBzip2},
+		{".tbz2", FormatTarBzip2},
+		{".tar.zst", FormatTarZstd},
+		{".tzst", FormatTarZstd},
+	} {
+		if strings.HasSuffix(name, s.ext) {
+			return s.format
+		}
+	}
+
+	return FormatUnknown
+}
+
+// detectArchiveFormat identifies the archive format from the first bytes of
+// an archive.
+func detectArchiveFormat(header []byte) ArchiveFormat {
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return FormatZip
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return FormatTarGzip
+	case bytes.HasPrefix(header, []byte("BZh")):
+		return FormatTarBzip2
+	case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return FormatTarZstd
+	case len(header) >= 262 && bytes.Equal(header[257:262], []byte("ustar")):
+		return FormatTar
+	default:
+		return FormatUnknown
+	}
+}
+
+const (
+	// DefaultExtractMaxSize is the default limit on the total number of
+	// bytes written by [Extract].
+	DefaultExtractMaxSize int64 = 64 << 30 // 64 GiB
+	// DefaultExtractMaxFiles is the default limit on the number of entries
+	// extracted by [Extract].
+	DefaultExtractMaxFiles = 1_000_000
+)
+
+// ErrExtractLimit is returned by [Extract] when an archive exceeds the
+// configured size or file count limits.
+var ErrExtractLimit = errors.New("archive exceeds extraction limits")
+
+// ExtractOptions configures [Extract].
+type ExtractOptions struct {
+	// Format of the archive. When FormatUnknown, the format is detected
+	// from the archive contents.
+	Format ArchiveFormat
+	// MaxSize limits the total number of bytes extracted. Zero uses
+	// DefaultExtractMaxSize and a negative value disables the limit.
+	MaxSize int64
+	// MaxFiles limits the number of entries extracted. Zero uses
+	// DefaultExtractMaxFiles and a negative value disables the limit.
+	MaxFiles int
+}
+
+// Extract extracts the archive at src into the directory dst, creating dst
+// if it doesn't exist. Supported formats are zip, tar, and tar compressed
+// with gzip, bzip2 or zstd.
+//
+// Entries are written through an [os.Root] opened on dst: entries with
+// absolute paths or paths escaping dst, and symbolic or hard links pointing
+// outside dst, are rejected. Extraction fails with [ErrExtractLimit] when the
+// archive exceeds the configured limits. File modes and modification times
+// are preserved; device files, named pipes and sockets are skipped.
+//
+// If Extract fails, dst may be left with partially extracted contents.
+func Extract(ctx context.Context, src, dst string, opts ExtractOptions) error {
+	if opts.MaxSize == 0 {
+		opts.MaxSize = DefaultExtractMaxSize
+	}
+	if opts.MaxFiles == 0 {
+		opts.MaxFiles = DefaultExtractMaxFiles
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("extract: %v", err)
+	}
+	defer f.Close()
+
+	format := opts.Format
+	if format == FormatUnknown {
+		header := make([]byte, 512)
+		n, err := io.ReadFull(f, header)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("extract: %v", err)
+		}
+		if format = detectArchiveFormat(header[:n]); format == FormatUnknown {
+			return errors.New("extract: unknown archive format")
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("extract: %v", err)
+		}
+	}
+
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return fmt.Errorf("extract: %v", err)
+	}
+	root, err := os.OpenRoot(dst)
+	if err != nil {
+		return fmt.Errorf("extract: %v", err)
+	}
+	defer root.Close()
+
+	x := &extractor{ctx: ctx, dst: dst, root: root, opts: opts}
+	if format == FormatZip {
+		err = x.zip(f)
+	} else {
+		err = x.tar(f, format)
+	}
+	if err == nil {
+		err = x.finish()
+	}
+	if err != nil {
+		return fmt.Errorf("extract: %w", err)
+	}
+
+	return nil
+}
+
+// extractor writes archive entries into root while enforcing limits.
+type extractor struct {
+	ctx   context.Context
+	dst   string
+	root  *os.Root
+	opts  ExtractOptions
+	size  int64
+	files int
+	dirs  []extractedDir
+	links map[string]string // Targets of the extracted symbolic links.
+}
+
+// extractedDir records the metadata of a directory to apply once all of its
+// contents have been extracted.
+type extractedDir struct {
+	name  string
+	mode  fs.FileMode
+	mtime time.Time
+}
+
+func (x *extractor) zip(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	for _, zf := range zr.File {
+		if err := x.entry(); err != nil {
+			return err
+		}
+		name, err := localName(zf.Name)
+		if err != nil {
+			return err
+		}
+		mode := zf.Mode()
+
+		switch {
+		case mode.IsDir():
+			err = x.dir(name, mode, zf.Modified)
+		case mode&fs.ModeSymlink != 0:
+			err = x.zipSymlink(name, zf)
+		case mode.IsRegular():
+			if zf.UncompressedSize64 > uint64(x.remaining()) {
+				return ErrExtractLimit
+			}
+			var rc io.ReadCloser
+			rc, err = zf.Open()
+			if err != nil {
+				return err
+			}
+			err = x.file(name, rc, mode, zf.Modified)
+			rc.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (x *extractor) zipSymlink(name string, zf *zip.File) error {
+	rc, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	target, err := io.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return err
+	}
+
+	return x.symlink(name, string(target))
+}
+
+func (x *extractor) tar(r io.Reader, format ArchiveFormat) error {
+	var err error
+	br := bufio.NewReader(r)
+	switch format {
+	case FormatTar:
+		r = br
+	case FormatTarGzip:
+		var gr *gzip.Reader
+		if gr, err = gzip.NewReader(br); err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	case FormatTarBzip2:
+		r = bzip2.NewReader(br)
+	case FormatTarZstd:
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(br); err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return fmt.Errorf("unsupported archive format %s", format)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		if err := x.entry(); err != nil {
+			return err
+		}
+		name, err := localName(hdr.Name)
+		if err != nil {
+			return err
+		}
+		mode := hdr.FileInfo().Mode()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(name, mode, hdr.ModTime)
+		case tar.TypeReg:
+			if hdr.Size > x.remaining() {
+				return ErrExtractLimit
+			}
+			err = x.file(name, tr, mode, hdr.ModTime)
+		case tar.TypeSymlink:
+			err = x.symlink(name, hdr.Linkname)
+		case tar.TypeLink:
+			err = x.link(name, hdr.Linkname)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// entry checks the context and the file count limit before an entry is
+// extracted.
+func (x *extractor) entry() error {
+	if err := x.ctx.Err(); err != nil {
+		return err
+	}
+	x.files++
+	if x.opts.MaxFiles > 0 && x.files > x.opts.MaxFiles {
+		return ErrExtractLimit
+	}
+	return nil
+}
+
+// remaining returns the number of bytes that can still be extracted.
+func (x *extractor) remaining() int64 {
+	if x.opts.MaxSize < 0 {
+		return 1<<63 - 1
+	}
+	return x.opts.MaxSize - x.size
+}
+
+func (x *extractor) dir(name string, mode fs.FileMode, mtime time.Time) error {
+	if name == "." {
+		return nil
+	}
+	if err := x.parent(name); err != nil {
+		return err
+	}
+	// Keep the directory writable until all its contents are extracted.
+	if err := x.root.MkdirAll(name, 0o700); err != nil {
+		return err
+	}
+	x.dirs = append(x.dirs, extractedDir{name: name, mode: mode.Perm(), mtime: mtime})
+
+	return nil
+}
+
+func (x *extractor) file(name string, r io.Reader, mode fs.FileMode, mtime time.Time) error {
+	if err := x.parent(name); err != nil {
+		return err
+	}
+
+	f, err := x.root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+
+	limit := x.remaining()
+	n, err := io.Copy(f, io.LimitReader(&contextReader{ctx: x.ctx, r: r}, limit+1))
+	x.size += n
+	if err == nil && n > limit {
+		err = ErrExtractLimit
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := x.root.Chmod(name, mode.Perm()); err != nil {
+		return err
+	}
+
+	return x.root.Chtimes(name, mtime, mtime)
+}
+
+func (x *extractor) symlink(name, target string) error {
+	if err := x.parent(name); err != nil {
+		return err
+	}
+	if err := x.checkSymlink(name, target); err != nil {
+		return err
+	}
+	if err := x.root.Symlink(target, name); err != nil {
+		return err
+	}
+	if x.links == nil {
+		x.links = map[string]string{}
+	}
+	x.links[name] = target
+
+	return nil
+}
+
+// checkSymlink rejects a symbolic link at name whose target, resolved through
+// the symbolic links already extracted, is outside the destination.
+func (x *extractor) checkSymlink(name, target string) error {
+	if filepath.IsAbs(target) || !filepath.IsLocal(path.Join(path.Dir(name), target)) {
+		return fmt.Errorf("symlink %q points outside the destination: %q", name, target)
+	}
+	// Join without cleaning: ".." elements must be resolved after the
+	// symbolic links preceding them.
+	p := target
+	if dir := path.Dir(name); dir != "." {
+		p = dir + "/" + target
+	}
+	if _, err := resolveInRoot(x.dst, p); err != nil {
+		return fmt.Errorf("symlink %q points outside the destination: %q", name, target)
+	}
+
+	return nil
+}
+
+func (x *extractor) link(name, target string) error {
+	target, err := localName(target)
+	if err != nil {
+		return err
+	}
+	// A hard link to a symbolic link would copy its relative target to a
+	// location where it may point outside the destination.
+	if fi, err := x.root.Lstat(target); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+		return fmt.Errorf("hard link %q points to symlink %q", name, target)
+	}
+	if err := x.parent(name); err != nil {
+		return err
+	}
+
+	return x.root.Link(target, name)
+}
+
+// parent creates the parent directories of name. It rejects names inside an
+// extracted symbolic link, which could otherwise be used to place entries
+// outside their apparent location.
+func (x *extractor) parent(name string) error {
+	dir := path.Dir(name)
+	if dir == "." {
+		return nil
+	}
+	for d := dir; d != "."; d = path.Dir(d) {
+		if _, ok := x.links[d]; ok {
+			return fmt.Errorf("entry %q is inside symlink %q", name, d)
+		}
+	}
+
+	return x.root.MkdirAll(dir, 0o755)
+}
+
+// finish checks the extracted symbolic links again, as links extracted later
+// may have changed where they resolve, and applies the modes and modification
+// times of the extracted directories, deepest first so that setting them isn't
+// undone by changes to their contents.
+func (x *extractor) finish() error {
+	for _, name := range slices.Sorted(maps.Keys(x.links)) {
+		if err := x.checkSymlink(name, x.links[name]); err != nil {
+			return err
+		}
+	}
+
+	slices.Reverse(x.dirs)
+	for _, d := range x.dirs {
+		if err := x.root.Chmod(d.name, d.mode); err != nil {
+			return err
+		}
+		if err := x.root.Chtimes(d.name, d.mtime, d.mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localName converts an archive entry name to a local slash-separated path,
+// rejecting names that are absolute or escape the destination.
+func localName(name string) (string, error) {
+	clean := path.Clean(strings.TrimPrefix(name, "./"))
+	if clean == "." {
+		return clean, nil
+	}
+	if !filepath.IsLocal(filepath.FromSlash(clean)) {
+		return "", fmt.Errorf("invalid entry name %q", name)
+	}
+	return clean, nil
+}
+
+// contextReader aborts reads once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// ArchiveOptions configures [Archive].
+type ArchiveOptions struct {
+	// Format of the archive. When FormatUnknown, the format is chosen from
+	// the extension of the destination.
+	Format ArchiveFormat
+}
+
+// Archive creates an archive at dst with the contents of the directory src.
+// Entry names are relative to src, and file modes, modification times and
+// symbolic links are preserved. Archive fails if dst already exists, and
+// removes the partially written archive on failure.
+func Archive(ctx context.Context, src, dst string, opts ArchiveOptions) (err error) {
+	format := opts.Format
+	if format == FormatUnknown {
+		format = ArchiveFormatFromName(dst)
+	}
+	if format == FormatUnknown {
+		return errors.New("archive: unknown archive format")
+	}
+
+	if fi, err := os.Stat(src); err != nil {
+		return fmt.Errorf("archive: %v", err)
+	} else if !fi.IsDir() {
+		return fmt.Errorf("archive: %s is not a directory", src)
+	}
+
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("archive: %v", err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("archive: %v", cerr)
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	bw := bufio.NewWriter(f)
+	if format == FormatZip {
+		err = archiveZip(ctx, src, bw)
+	} else {
+		err = archiveTar(ctx, src, bw, format)
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+
+	return nil
+}
+
+// archiveEntry is a walked file to be written to an archive.
+type archiveEntry struct {
+	path string // Path on disk.
+	name string // Slash-separated name relative to the archived directory.
+	info fs.FileInfo
+	link string // Target of symbolic links.
+}
+
+// walkArchive calls fn for every entry in src except src itself.
+func walkArchive(ctx context.Context, src string, fn func(e archiveEntry) error) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p == src {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e := archiveEntry{path: p, name: filepath.ToSlash(rel), info: info}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if e.link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+
+		return fn(e)
+	})
+}
+
+func archiveTar(ctx context.Context, src string, w io.Writer, format ArchiveFormat) error {
+	var cw io.WriteCloser
+	var err error
+	switch format {
+	case FormatTar:
+		cw = nopWriteCloser{w}
+	case FormatTarGzip:
+		cw = gzip.NewWriter(w)
+	case FormatTarBzip2:
+		cw, err = dsnetbzip2.NewWriter(w, nil)
+	case FormatTarZstd:
+		cw, err = zstd.NewWriter(w)
+	default:
+		err = fmt.Errorf("unsupported archive format %s", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(cw)
+	err = walkArchive(ctx, src, func(e archiveEntry) error {
+		if !e.info.IsDir() && !e.info.Mode().IsRegular() && e.link == "" {
+			return nil // Skip special files.
+		}
+
+		hdr, err := tar.FileInfoHeader(e.info, e.link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = e.name
+		if e.info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if e.info.Mode().IsRegular() {
+			return copyFileTo(ctx, tw, e.path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return cw.Close()
+}
+
+func archiveZip(ctx context.Context, src string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	err := walkArchive(ctx, src, func(e archiveEntry) error {
+		if !e.info.IsDir() && !e.info.Mode().IsRegular() && e.link == "" {
+			return nil // Skip special files.
+		}
+
+		hdr, err := zip.FileInfoHeader(e.info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = e.name
+		if e.info.IsDir() {
+			hdr.Name += "/"
+		} else if e.info.Mode().IsRegular() {
+			hdr.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case e.link != "":
+			_, err = io.WriteString(fw, e.link)
+		case e.info.Mode().IsRegular():
+			err = copyFileTo(ctx, fw, e.path)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// copyFileTo copies the contents of the file at path to w.
+func copyFileTo(ctx context.Context, w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, &contextReader{ctx: ctx, r: f})
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,277 @@
+package fsutil_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	tfs "gotest.tools/v3/fs"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+var archiveOpts = []tfs.PathOp{
+	tfs.WithFile("foo.txt", "foo", tfs.WithMode(0o600)),
+	tfs.WithDir("sub", tfs.WithMode(0o750),
+		tfs.WithFile("bar.txt", "bar", tfs.WithMode(0o644)),
+	),
+}
+
+// newArchiveSrc returns a directory to archive with a relative symlink.
+func newArchiveSrc(t *testing.T) *tfs.Dir {
+	t.Helper()
+
+	td := tfs.NewDir(t, "enduro-test-fsutil", archiveOpts...)
+	assert.NilError(t, os.Symlink("bar.txt", td.Join("sub", "link")))
+
+	return td
+}
+
+// writeTar writes a tar archive with the given headers and contents to a
+// temporary file and returns its path.
+func writeTar(t *testing.T, entries map[*tar.Header]string) string {
+	t.Helper()
+
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for hdr, content := range entries {
+		hdr.Size = int64(len(content))
+		assert.NilError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(content))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, tw.Close())
+
+	p := filepath.Join(t.TempDir(), "archive.tar")
+	assert.NilError(t, os.WriteFile(p, b.Bytes(), 0o600))
+
+	return p
+}
+
+// writeTarHeaders writes a tar archive with the given empty entries, in order,
+// and returns its path.
+func writeTarHeaders(t *testing.T, hdrs ...*tar.Header) string {
+	t.Helper()
+
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for _, hdr := range hdrs {
+		assert.NilError(t, tw.WriteHeader(hdr))
+	}
+	assert.NilError(t, tw.Close())
+
+	p := filepath.Join(t.TempDir(), "archive.tar")
+	assert.NilError(t, os.WriteFile(p, b.Bytes(), 0o600))
+
+	return p
+}
+
+func TestArchiveFormatFromName(t *testing.T) {
+	t.Parallel()
+
+	for name, want := range map[string]fsutil.ArchiveFormat{
+		"transfer.zip":     fsutil.FormatZip,
+		"transfer.tar":     fsutil.FormatTar,
+		"transfer.TAR.GZ":  fsutil.FormatTarGzip,
+		"transfer.tgz":     fsutil.FormatTarGzip,
+		"transfer.tar.bz2": fsutil.FormatTarBzip2,
+		"transfer.tar.zst": fsutil.FormatTarZstd,
+		"transfer.gz":      fsutil.FormatUnknown,
+		"transfer":         fsutil.FormatUnknown,
+	} {
+		assert.Equal(t, fsutil.ArchiveFormatFromName(name), want, name)
+	}
+}
+
+func TestArchiveExtract(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{
+		"transfer.zip",
+		"transfer.tar",
+		"transfer.tar.gz",
+		"transfer.tar.bz2",
+		"transfer.tar.zst",
+	} {
+		t.Run("Round trips "+name, func(t *testing.T) {
+			t.Parallel()
+
+			src := newArchiveSrc(t)
+			mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			assert.NilError(t, os.Chtimes(src.Join("foo.txt"), mtime, mtime))
+			manifest := tfs.ManifestFromDir(t, src.Path())
+
+			archive := filepath.Join(t.TempDir(), name)
+			err := fsutil.Archive(context.Background(), src.Path(), archive, fsutil.ArchiveOptions{})
+			assert.NilError(t, err)
+
+			dst := tfs.NewDir(t, "enduro-test-fsutil").Path()
+			err = fsutil.Extract(context.Background(), archive, dst, fsutil.ExtractOptions{})
+			assert.NilError(t, err)
+
+			assert.Assert(t, tfs.Equal(dst, manifest))
+			fi, err := os.Stat(filepath.Join(dst, "foo.txt"))
+			assert.NilError(t, err)
+			assert.Assert(t, fi.ModTime().Equal(mtime))
+		})
+	}
+
+	t.Run("Archive fails if the destination exists", func(t *testing.T) {
+		t.Parallel()
+
+		src := newArchiveSrc(t)
+		dst := tfs.NewFile(t, "enduro-test-fsutil")
+
+		err := fsutil.Archive(context.Background(), src.Path(), dst.Path(), fsutil.ArchiveOptions{
+			Format: fsutil.FormatZip,
+		})
+		assert.ErrorContains(t, err, "file exists")
+	})
+
+	t.Run("Archive fails with an unknown format", func(t *testing.T) {
+		t.Parallel()
+
+		src := newArchiveSrc(t)
+		dst := filepath.Join(t.TempDir(), "transfer.rar")
+
+		err := fsutil.Archive(context.Background(), src.Path(), dst, fsutil.ArchiveOptions{})
+		assert.Error(t, err, "archive: unknown archive format")
+	})
+}
+
+func TestExtract(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Rejects entries escaping the destination", func(t *testing.T) {
+		t.Parallel()
+
+		var b bytes.Buffer
+		zw := zip.NewWriter(&b)
+		_, err := zw.Create("../evil.txt")
+		assert.NilError(t, err)
+		assert.NilError(t, zw.Close())
+		archive := filepath.Join(t.TempDir(), "evil.zip")
+		assert.NilError(t, os.WriteFile(archive, b.Bytes(), 0o600))
+
+		dst := t.TempDir()
+		err = fsutil.Extract(context.Background(), archive, filepath.Join(dst, "dst"), fsutil.ExtractOptions{})
+		assert.Error(t, err, `extract: invalid entry name "../evil.txt"`)
+		assert.Equal(t, fsutil.FileExists(filepath.Join(dst, "evil.txt")), false)
+	})
+
+	t.Run("Rejects symlinks escaping the destination", func(t *testing.T) {
+		t.Parallel()
+
+		archive := writeTar(t, map[*tar.Header]string{
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd"}: "",
+		})
+
+		err := fsutil.Extract(context.Background(), archive, t.TempDir(), fsutil.ExtractOptions{})
+		assert.Error(t, err, `extract: symlink "link" points outside the destination: "../../etc/passwd"`)
+	})
+
+	t.Run("Rejects entries inside an extracted symlink", func(t *testing.T) {
+		t.Parallel()
+
+		var b bytes.Buffer
+		tw := tar.NewWriter(&b)
+		assert.NilError(t, tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "."}))
+		assert.NilError(t, tw.WriteHeader(&tar.Header{Name: "link/up", Typeflag: tar.TypeSymlink, Linkname: ".."}))
+		assert.NilError(t, tw.Close())
+		archive := filepath.Join(t.TempDir(), "archive.tar")
+		assert.NilError(t, os.WriteFile(archive, b.Bytes(), 0o600))
+
+		err := fsutil.Extract(context.Background(), archive, t.TempDir(), fsutil.ExtractOptions{})
+		assert.Error(t, err, `extract: entry "link/up" is inside symlink "link"`)
+	})
+
+	t.Run("Rejects chains of symlinks escaping the destination", func(t *testing.T) {
+		t.Parallel()
+
+		archive := writeTarHeaders(t,
+			&tar.Header{Name: "a/l", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			&tar.Header{Name: "a/m", Typeflag: tar.TypeSymlink, Linkname: "l/.."},
+		)
+
+		err := fsutil.Extract(context.Background(), archive, t.TempDir(), fsutil.ExtractOptions{})
+		assert.Error(t, err, `extract: symlink "a/m" points outside the destination: "l/.."`)
+	})
+
+	t.Run("Rejects symlinks escaping the destination through later symlinks", func(t *testing.T) {
+		t.Parallel()
+
+		archive := writeTarHeaders(t,
+			&tar.Header{Name: "a/m", Typeflag: tar.TypeSymlink, Linkname: "l/.."},
+			&tar.Header{Name: "a/l", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		)
+
+		err := fsutil.Extract(context.Background(), archive, t.TempDir(), fsutil.ExtractOptions{})
+		assert.Error(t, err, `extract: symlink "a/m" points outside the destination: "l/.."`)
+	})
+
+	t.Run("Rejects hard links to symlinks", func(t *testing.T) {
+		t.Parallel()
+
+		archive := writeTarHeaders(t,
+			&tar.Header{Name: "a/b/l", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+			&tar.Header{Name: "x", Typeflag: tar.TypeLink, Linkname: "a/b/l"},
+		)
+
+		dst := t.TempDir()
+		err := fsutil.Extract(context.Background(), archive, dst, fsutil.ExtractOptions{})
+		assert.Error(t, err, `extract: hard link "x" points to symlink "a/b/l"`)
+		_, err = os.Lstat(filepath.Join(dst, "x"))
+		assert.Assert(t, os.IsNotExist(err))
+	})
+
+	t.Run("Enforces the size limit", func(t *testing.T) {
+		t.Parallel()
+
+		archive := writeTar(t, map[*tar.Header]string{
+			{Name: "big.txt", Typeflag: tar.TypeReg, Mode: 0o644}: "0123456789",
+		})
+
+		err := fsutil.Extract(context.Background(), archive, t.TempDir(), fsutil.ExtractOptions{MaxSize: 5})
+		assert.ErrorIs(t, err, fsutil.ErrExtractLimit)
+	})
+
+	t.Run("Enforces the file count limit", func(t *testing.T) {
+		t.Parallel()
+
+		archive := writeTar(t, map[*tar.Header]string{
+			{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0o644}: "a",
+			{Name: "b.txt", Typeflag: tar.TypeReg, Mode: 0o644}: "b",
+		})
+
+		err := fsutil.Extract(context.Background(), archive, t.TempDir(), fsutil.ExtractOptions{MaxFiles: 1})
+		assert.ErrorIs(t, err, fsutil.ErrExtractLimit)
+	})
+
+	t.Run("Fails if the context is canceled", func(t *testing.T) {
+		t.Parallel()
+
+		archive := writeTar(t, map[*tar.Header]string{
+			{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0o644}: "a",
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := fsutil.Extract(ctx, archive, t.TempDir(), fsutil.ExtractOptions{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Fails with an unknown format", func(t *testing.T) {
+		t.Parallel()
+
+		archive := tfs.NewFile(t, "enduro-test-fsutil", tfs.WithContent("not an archive"))
+
+		err := fsutil.Extract(context.Background(), archive.Path(), t.TempDir(), fsutil.ExtractOptions{})
+		assert.Error(t, err, "extract: unknown archive format")
+	})
+}
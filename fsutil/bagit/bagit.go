@@ -0,0 +1,320 @@
+// Package bagit creates, validates and extracts BagIt bags as described in
+// RFC 8493.
+//
+// Use [Create] to turn a directory into a bag in place, [Validate] to check a
+// bag's completeness and fixity and [Unbag] to move a valid bag's payload to a
+// new location:
+//
+//	if err := bagit.Create(ctx, dir, bagit.Config{}); err != nil {
+//		return err
+//	}
+//	if err := bagit.Validate(ctx, dir); err != nil {
+//		return err
+//	}
+//
+// Files are hashed as they are read, with every configured algorithm computed
+// in a single pass, so payloads of any size can be processed.
+package bagit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+const (
+	// Version is the BagIt version of the bags created by this package.
+	Version = "1.0"
+
+	dataDir     = "data"
+	bagitTxt    = "bagit.txt"
+	bagInfoTxt  = "bag-info.txt"
+	softwareTag = "go.artefactual.dev/tools/fsutil/bagit"
+)
+
+// now returns the current time. Changing now should only be done in tests.
+var now = time.Now
+
+// Config configures the creation of a bag.
+type Config struct {
+	// Algorithms used to build the payload and tag manifests. Defaults to
+	// SHA512.
+	Algorithms []Algorithm
+	// Info holds additional bag-info.txt metadata, e.g. "Source-Organization".
+	// Bagging-Date, Payload-Oxum and Bag-Software-Agent are always set.
+	Info map[string]string
+}
+
+// Create turns the directory at dir into a bag: its contents are moved into
+// the data/ payload directory and the bag declaration, bag-info.txt, payload
+// manifests and tag manifests are written alongside it.
+//
+// Create returns an error if dir is already a bag. If Create fails part way
+// through, dir may be left in a partially bagged state.
+func Create(ctx context.Context, dir string, cfg Config) error {
+	algs := cfg.Algorithms
+	if len(algs) == 0 {
+		algs = []Algorithm{SHA512}
+	}
+	for _, alg := range algs {
+		if _, err := alg.newHash(); err != nil {
+			return fmt.Errorf("create bag: %v", err)
+		}
+	}
+
+	if fi, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("create bag: %v", err)
+	} else if !fi.IsDir() {
+		return fmt.Errorf("create bag: %s is not a directory", dir)
+	}
+	if fsutil.FileExists(filepath.Join(dir, bagitTxt)) {
+		return fmt.Errorf("create bag: %s is already a bag", dir)
+	}
+
+	if err := movePayload(dir); err != nil {
+		return fmt.Errorf("create bag: %v", err)
+	}
+
+	manifests := make(map[Algorithm]manifest, len(algs))
+	for _, alg := range algs {
+		manifests[alg] = manifest{}
+	}
+
+	var oxumBytes, oxumFiles int64
+	err := filepath.WalkDir(filepath.Join(dir, dataDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		sums, n, err := checksums(ctx, path, algs)
+		if err != nil {
+			return err
+		}
+		rel, err := relPath(dir, path)
+		if err != nil {
+			return err
+		}
+		for alg, sum := range sums {
+			manifests[alg][rel] = sum
+		}
+		oxumBytes += n
+		oxumFiles++
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("create bag: %v", err)
+	}
+
+	decl := fmt.Sprintf("BagIt-Version: %s\nTag-File-Character-Encoding: UTF-8\n", Version)
+	if err := os.WriteFile(filepath.Join(dir, bagitTxt), []byte(decl), 0o644); err != nil {
+		return fmt.Errorf("create bag: %v", err)
+	}
+
+	info := maps.Clone(cfg.Info)
+	if info == nil {
+		info = map[string]string{}
+	}
+	info["Bagging-Date"] = now().Format(time.DateOnly)
+	info["Payload-Oxum"] = fmt.Sprintf("%d.%d", oxumBytes, oxumFiles)
+	info["Bag-Software-Agent"] = softwareTag
+	if err := writeInfo(filepath.Join(dir, bagInfoTxt), info); err != nil {
+		return fmt.Errorf("create bag: %v", err)
+	}
+
+	for alg, m := range manifests {
+		if err := writeManifest(filepath.Join(dir, "manifest-"+string(alg)+".txt"), m); err != nil {
+			return fmt.Errorf("create bag: %v", err)
+		}
+	}
+
+	if err := writeTagManifests(ctx, dir, algs); err != nil {
+		return fmt.Errorf("create bag: %v", err)
+	}
+
+	return nil
+}
+
+// Unbag validates the bag at dir and moves its payload to dst, which must not
+// exist. The tag files are left in dir.
+func Unbag(ctx context.Context, dir, dst string) error {
+	if err := Validate(ctx, dir); err != nil {
+		return err
+	}
+	if err := fsutil.Move(filepath.Join(dir, dataDir), dst); err != nil {
+		return fmt.Errorf("unbag: %v", err)
+	}
+
+	return nil
+}
+
+// movePayload moves the contents of dir into a new data/ subdirectory.
+func movePayload(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// Use a temporary directory in case the payload has a "data" entry.
+	tmp, err := os.MkdirTemp(dir, ".bagit-")
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := fsutil.Move(filepath.Join(dir, e.Name()), filepath.Join(tmp, e.Name())); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(tmp, 0o755); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(dir, dataDir))
+}
+
+// writeTagManifests writes a tag manifest for every algorithm covering all
+// the tag files in dir.
+func writeTagManifests(ctx context.Context, dir string, algs []Algorithm) error {
+	tagFiles, err := tagFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	manifests := make(map[Algorithm]manifest, len(algs))
+	for _, alg := range algs {
+		manifests[alg] = manifest{}
+	}
+	for _, name := range tagFiles {
+		sums, _, err := checksums(ctx, filepath.Join(dir, name), algs)
+		if err != nil {
+			return err
+		}
+		for alg, sum := range sums {
+			manifests[alg][name] = sum
+		}
+	}
+	for alg, m := range manifests {
+		if err := writeManifest(filepath.Join(dir, "tagmanifest-"+string(alg)+".txt"), m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tagFiles returns the slash-separated paths of the files in dir that are not
+// part of the payload or a tag manifest.
+func tagFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := relPath(dir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if rel == dataDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(rel, "tagmanifest-") {
+			files = append(files, rel)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// relPath returns the slash-separated path of target relative to base.
+func relPath(base, target string) (string, error) {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// writeInfo writes the bag-info.txt file at path, sorted by label.
+func writeInfo(path string, info map[string]string) error {
+	var b strings.Builder
+	for _, label := range slices.Sorted(maps.Keys(info)) {
+		fmt.Fprintf(&b, "%s: %s\n", label, info[label])
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// readTags parses the tag file at path, e.g. bagit.txt or bag-info.txt.
+// Values spanning multiple lines are joined with a single space.
+func readTags(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tags := map[string][]string{}
+	var last string
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSuffix(s.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		if text[0] == ' ' || text[0] == '\t' {
+			if last == "" {
+				return nil, fmt.Errorf("%s: line %d: unexpected continuation line", filepath.Base(path), line)
+			}
+			vals := tags[last]
+			vals[len(vals)-1] += " " + strings.TrimSpace(text)
+			continue
+		}
+		label, value, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s: line %d: invalid tag", filepath.Base(path), line)
+		}
+		last = strings.TrimSpace(label)
+		tags[last] = append(tags[last], strings.TrimSpace(value))
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// parseOxum parses a Payload-Oxum value into its octet and stream counts.
+func parseOxum(v string) (int64, int64, error) {
+	octets, streams, ok := strings.Cut(v, ".")
+	if !ok {
+		return 0, 0, errors.New("invalid Payload-Oxum")
+	}
+	o, err := strconv.ParseInt(octets, 10, 64)
+	if err != nil {
+		return 0, 0, errors.New("invalid Payload-Oxum")
+	}
+	s, err := strconv.ParseInt(streams, 10, 64)
+	if err != nil {
+		return 0, 0, errors.New("invalid Payload-Oxum")
+	}
+
+	return o, s, nil
+}
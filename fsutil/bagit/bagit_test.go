@@ -0,0 +1,217 @@
+package bagit_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+	"gotest.tools/v3/fs"
+
+	"go.artefactual.dev/tools/fsutil/bagit"
+)
+
+var transferOpts = []fs.PathOp{
+	fs.WithFile("foo.txt", "foo"),
+	fs.WithDir("data", fs.WithFile("bar.txt", "bar")),
+}
+
+func createBag(t *testing.T) *fs.Dir {
+	t.Helper()
+
+	td := fs.NewDir(t, "bagit", transferOpts...)
+	err := bagit.Create(context.Background(), td.Path(), bagit.Config{
+		Algorithms: []bagit.Algorithm{bagit.SHA256, bagit.MD5},
+		Info:       map[string]string{"Source-Organization": "Artefactual"},
+	})
+	assert.NilError(t, err)
+
+	return td
+}
+
+func TestCreate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Creates a bag", func(t *testing.T) {
+		t.Parallel()
+
+		td := createBag(t)
+
+		assert.Assert(t, fs.Equal(td.Path(), fs.Expected(t,
+			fs.WithDir("data", fs.WithMode(0o755),
+				fs.WithFile("foo.txt", "foo"),
+				fs.WithDir("data", fs.WithFile("bar.txt", "bar")),
+			),
+			fs.WithFile("bagit.txt", "BagIt-Version: 1.0\nTag-File-Character-Encoding: UTF-8\n"),
+			fs.WithFile("bag-info.txt", "", fs.MatchAnyFileContent),
+			fs.WithFile("manifest-sha256.txt",
+				"fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9  data/data/bar.txt\n"+
+					"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae  data/foo.txt\n",
+			),
+			fs.WithFile("manifest-md5.txt", "", fs.MatchAnyFileContent),
+			fs.WithFile("tagmanifest-sha256.txt", "", fs.MatchAnyFileContent),
+			fs.WithFile("tagmanifest-md5.txt", "", fs.MatchAnyFileContent),
+		)))
+
+		info, err := os.ReadFile(td.Join("bag-info.txt"))
+		assert.NilError(t, err)
+		assert.Assert(t, cmp.Contains(string(info), "Payload-Oxum: 6.2\n"))
+		assert.Assert(t, cmp.Contains(string(info), "Source-Organization: Artefactual\n"))
+		assert.Assert(t, cmp.Contains(string(info), "Bagging-Date: "))
+	})
+
+	t.Run("Fails if the directory is already a bag", func(t *testing.T) {
+		t.Parallel()
+
+		td := createBag(t)
+
+		err := bagit.Create(context.Background(), td.Path(), bagit.Config{})
+		assert.ErrorContains(t, err, "is already a bag")
+	})
+
+	t.Run("Fails with an unsupported algorithm", func(t *testing.T) {
+		t.Parallel()
+
+		td := fs.NewDir(t, "bagit", transferOpts...)
+
+		err := bagit.Create(context.Background(), td.Path(), bagit.Config{
+			Algorithms: []bagit.Algorithm{"crc32"},
+		})
+		assert.Error(t, err, `create bag: unsupported algorithm "crc32"`)
+	})
+
+	t.Run("Fails if the context is canceled", func(t *testing.T) {
+		t.Parallel()
+
+		td := fs.NewDir(t, "bagit", transferOpts...)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := bagit.Create(ctx, td.Path(), bagit.Config{})
+		assert.ErrorContains(t, err, "context canceled")
+	})
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	type test struct {
+		name   string
+		modify func(t *testing.T, td *fs.Dir)
+		want   []string
+	}
+
+	for _, tc := range []test{
+		{
+			name: "Validates a bag",
+		},
+		{
+			name: "Reports a modified payload file",
+			modify: func(t *testing.T, td *fs.Dir) {
+				fs.Apply(t, td, fs.WithDir("data", fs.WithFile("foo.txt", "oof")))
+			},
+			want: []string{
+				"manifest-md5.txt: data/foo.txt checksum mismatch: want acbd18db4cc2f85cedef654fccc4a4d8, got b4453d1f9f5386a1846e57a3ec95678f",
+				"manifest-sha256.txt: data/foo.txt checksum mismatch: want 2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae, got 7a7457781dd9bf0706e5334c5d30af0a4a8d461521fbd46a584a31fe8c4d9965",
+			},
+		},
+		{
+			name: "Reports missing and unlisted payload files",
+			modify: func(t *testing.T, td *fs.Dir) {
+				assert.NilError(t, os.Remove(td.Join("data", "foo.txt")))
+				fs.Apply(t, td, fs.WithDir("data", fs.WithFile("baz.txt", "baz")))
+			},
+			want: []string{
+				"manifest-md5.txt: data/foo.txt is missing",
+				"manifest-md5.txt: data/baz.txt is not listed",
+				"manifest-sha256.txt: data/foo.txt is missing",
+				"manifest-sha256.txt: data/baz.txt is not listed",
+			},
+		},
+		{
+			name: "Reports a missing bag declaration",
+			modify: func(t *testing.T, td *fs.Dir) {
+				assert.NilError(t, os.Remove(td.Join("bagit.txt")))
+			},
+			want: []string{
+				"missing bagit.txt",
+				"tagmanifest-md5.txt: bagit.txt is missing",
+				"tagmanifest-sha256.txt: bagit.txt is missing",
+			},
+		},
+		{
+			name: "Reports a modified tag file",
+			modify: func(t *testing.T, td *fs.Dir) {
+				fs.Apply(t, td, fs.WithFile("bag-info.txt", "Payload-Oxum: 6.2\n"))
+			},
+			want: []string{
+				"tagmanifest-md5.txt: bag-info.txt checksum mismatch",
+				"tagmanifest-sha256.txt: bag-info.txt checksum mismatch",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			td := createBag(t)
+			if tc.modify != nil {
+				tc.modify(t, td)
+			}
+
+			err := bagit.Validate(context.Background(), td.Path())
+			if len(tc.want) == 0 {
+				assert.NilError(t, err)
+				return
+			}
+
+			var verr *bagit.ValidationError
+			assert.Assert(t, errors.As(err, &verr))
+			assert.Equal(t, len(verr.Problems), len(tc.want), verr.Error())
+			for i, want := range tc.want {
+				assert.Assert(t, cmp.Contains(verr.Problems[i], want))
+			}
+		})
+	}
+}
+
+func TestValidateCompleteness(t *testing.T) {
+	t.Parallel()
+
+	td := createBag(t)
+	fs.Apply(t, td, fs.WithDir("data", fs.WithFile("foo.txt", "oof")))
+
+	err := bagit.ValidateCompleteness(context.Background(), td.Path())
+	assert.NilError(t, err)
+
+	fs.Apply(t, td, fs.WithDir("data", fs.WithFile("foo.txt", "foobar")))
+	err = bagit.ValidateCompleteness(context.Background(), td.Path())
+	assert.ErrorContains(t, err, "bag-info.txt: Payload-Oxum 6.2 does not match payload 9.2")
+}
+
+func TestUnbag(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Moves the payload of a valid bag", func(t *testing.T) {
+		t.Parallel()
+
+		td := createBag(t)
+		dst := fs.NewDir(t, "bagit")
+
+		err := bagit.Unbag(context.Background(), td.Path(), dst.Join("transfer"))
+		assert.NilError(t, err)
+		assert.Assert(t, fs.Equal(dst.Join("transfer"), fs.Expected(t, append(transferOpts, fs.WithMode(0o755))...)))
+	})
+
+	t.Run("Fails if the bag is not valid", func(t *testing.T) {
+		t.Parallel()
+
+		td := createBag(t)
+		fs.Apply(t, td, fs.WithDir("data", fs.WithFile("foo.txt", "oof")))
+		dst := fs.NewDir(t, "bagit")
+
+		err := bagit.Unbag(context.Background(), td.Path(), dst.Join("transfer"))
+		assert.ErrorContains(t, err, "invalid bag: ")
+	})
+}
@@ -0,0 +1,201 @@
+package bagit
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Algorithm is a checksum algorithm used in bag manifests.
+type Algorithm string
+
+const (
+	MD5    Algorithm = "md5"
+	SHA1   Algorithm = "sha1"
+	SHA256 Algorithm = "sha256"
+	SHA512 Algorithm = "sha512"
+)
+
+// newHash returns a new hash.Hash for the algorithm.
+func (a Algorithm) newHash() (hash.Hash, error) {
+	switch a {
+	case MD5:
+		return md5.New(), nil
+	case SHA1:
+		return sha1.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", string(a))
+	}
+}
+
+// manifest maps slash-separated paths relative to the bag root to their
+// lowercase hex encoded checksums.
+type manifest map[string]string
+
+// checksums computes the checksums of the file at path for every algorithm,
+// reading the file only once. It returns the number of bytes read.
+func checksums(ctx context.Context, path string, algs []Algorithm) (map[Algorithm]string, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	hashes := make(map[Algorithm]hash.Hash, len(algs))
+	writers := make([]io.Writer, 0, len(algs))
+	for _, alg := range algs {
+		h, err := alg.newHash()
+		if err != nil {
+			return nil, 0, err
+		}
+		hashes[alg] = h
+		writers = append(writers, h)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(io.MultiWriter(writers...), &ctxReader{ctx: ctx, r: f})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sums := make(map[Algorithm]string, len(algs))
+	for alg, h := range hashes {
+		sums[alg] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	return sums, n, nil
+}
+
+// ctxReader aborts reads once its context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// writeManifest writes m to the file at path, sorted by file path.
+func writeManifest(path string, m manifest) error {
+	paths := make([]string, 0, len(m))
+	for p := range m {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, p := range paths {
+		fmt.Fprintf(w, "%s  %s\n", m[p], encodePath(p))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// readManifest parses the manifest file at path.
+func readManifest(path string) (manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := manifest{}
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSuffix(s.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		sum, p, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("%s: line %d: invalid manifest entry", filepath.Base(path), line)
+		}
+		p = decodePath(strings.TrimLeft(p, " *"))
+		if !validPath(p) {
+			return nil, fmt.Errorf("%s: line %d: invalid path %q", filepath.Base(path), line, p)
+		}
+		m[p] = strings.ToLower(sum)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// manifestAlgorithms returns the algorithms of the manifest files found in
+// dir with the given prefix, e.g. "manifest" or "tagmanifest".
+func manifestAlgorithms(dir, prefix string) ([]Algorithm, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, prefix+"-*.txt"))
+	if err != nil {
+		return nil, err
+	}
+
+	algs := make([]Algorithm, 0, len(matches))
+	for _, m := range matches {
+		name := filepath.Base(m)
+		name = strings.TrimSuffix(strings.TrimPrefix(name, prefix+"-"), ".txt")
+		algs = append(algs, Algorithm(name))
+	}
+	slices.Sort(algs)
+
+	return algs, nil
+}
+
+// encodePath percent-encodes the characters that can't be represented in a
+// manifest line as required by RFC 8493, section 2.1.3.
+func encodePath(p string) string {
+	return pathEncoder.Replace(p)
+}
+
+// decodePath reverses encodePath.
+func decodePath(p string) string {
+	return pathDecoder.Replace(p)
+}
+
+var (
+	pathEncoder = strings.NewReplacer("%", "%25", "\n", "%0A", "\r", "%0D")
+	pathDecoder = strings.NewReplacer("%25", "%", "%0A", "\n", "%0a", "\n", "%0D", "\r", "%0d", "\r")
+)
+
+// validPath reports whether p is a clean, relative path that stays inside
+// the bag.
+func validPath(p string) bool {
+	if p == "" || path.IsAbs(p) || strings.Contains(p, `\`) {
+		return false
+	}
+	clean := path.Clean(p)
+	return clean == p && clean != ".." && !strings.HasPrefix(clean, "../")
+}
@@ -0,0 +1,258 @@
+package bagit
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+// ValidationError is returned by [Validate] and [ValidateCompleteness] when a
+// bag is incomplete or fails its fixity checks.
+type ValidationError struct {
+	// Problems lists every issue found in the bag.
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid bag: " + strings.Join(e.Problems, "; ")
+}
+
+func (e *ValidationError) add(format string, a ...any) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, a...))
+}
+
+// Validate checks that the bag at dir is complete and that the checksums of
+// its payload and tag files match their manifests. It returns a
+// [*ValidationError] listing every problem found when the bag is not valid.
+func Validate(ctx context.Context, dir string) error {
+	return validate(ctx, dir, true)
+}
+
+// ValidateCompleteness checks that the bag at dir is complete, i.e. that its
+// tag files are well formed, that every manifest entry exists and that every
+// payload file is listed in the manifests. Checksums are not verified. It
+// returns a [*ValidationError] listing every problem found.
+func ValidateCompleteness(ctx context.Context, dir string) error {
+	return validate(ctx, dir, false)
+}
+
+func validate(ctx context.Context, dir string, fixity bool) error {
+	verr := &ValidationError{}
+
+	validateDeclaration(dir, verr)
+	if fsutil.FileExists(filepath.Join(dir, "fetch.txt")) {
+		verr.add("fetch.txt is not supported")
+	}
+
+	payload, err := payloadSizes(dir)
+	if err != nil {
+		return fmt.Errorf("validate bag: %v", err)
+	}
+	if payload == nil {
+		verr.add("missing %s directory", dataDir)
+	}
+
+	payloadManifests, err := readManifests(dir, "manifest", verr)
+	if err != nil {
+		return fmt.Errorf("validate bag: %v", err)
+	}
+	if len(payloadManifests) == 0 {
+		verr.add("missing payload manifest")
+	}
+
+	// Completeness: every manifest entry exists and every payload file is in
+	// every manifest.
+	for _, alg := range slices.Sorted(maps.Keys(payloadManifests)) {
+		m := payloadManifests[alg]
+		for _, p := range slices.Sorted(maps.Keys(m)) {
+			if !strings.HasPrefix(p, dataDir+"/") {
+				verr.add("manifest-%s.txt: %s is outside the payload directory", alg, p)
+			} else if _, ok := payload[p]; !ok {
+				verr.add("manifest-%s.txt: %s is missing", alg, p)
+			}
+		}
+		for _, p := range slices.Sorted(maps.Keys(payload)) {
+			if _, ok := m[p]; !ok {
+				verr.add("manifest-%s.txt: %s is not listed", alg, p)
+			}
+		}
+	}
+
+	validateOxum(dir, payload, verr)
+
+	tagManifests, err := readManifests(dir, "tagmanifest", verr)
+	if err != nil {
+		return fmt.Errorf("validate bag: %v", err)
+	}
+	for _, alg := range slices.Sorted(maps.Keys(tagManifests)) {
+		for _, p := range slices.Sorted(maps.Keys(tagManifests[alg])) {
+			if !fsutil.FileExists(filepath.Join(dir, filepath.FromSlash(p))) {
+				verr.add("tagmanifest-%s.txt: %s is missing", alg, p)
+			}
+		}
+	}
+
+	if fixity {
+		if err := verifyFixity(ctx, dir, "manifest", payloadManifests, verr); err != nil {
+			return fmt.Errorf("validate bag: %v", err)
+		}
+		if err := verifyFixity(ctx, dir, "tagmanifest", tagManifests, verr); err != nil {
+			return fmt.Errorf("validate bag: %v", err)
+		}
+	}
+
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+
+	return nil
+}
+
+// validateDeclaration checks the bag declaration (bagit.txt).
+func validateDeclaration(dir string, verr *ValidationError) {
+	tags, err := readTags(filepath.Join(dir, bagitTxt))
+	if os.IsNotExist(err) {
+		verr.add("missing %s", bagitTxt)
+		return
+	} else if err != nil {
+		verr.add("%v", err)
+		return
+	}
+	for _, label := range []string{"BagIt-Version", "Tag-File-Character-Encoding"} {
+		if len(tags[label]) != 1 {
+			verr.add("%s: missing or repeated %s", bagitTxt, label)
+		}
+	}
+}
+
+// validateOxum compares the Payload-Oxum in bag-info.txt, if any, with the
+// actual payload.
+func validateOxum(dir string, payload map[string]int64, verr *ValidationError) {
+	tags, err := readTags(filepath.Join(dir, bagInfoTxt))
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		verr.add("%v", err)
+		return
+	}
+	if len(tags["Payload-Oxum"]) == 0 {
+		return
+	}
+
+	octets, streams, err := parseOxum(tags["Payload-Oxum"][0])
+	if err != nil {
+		verr.add("%s: %v", bagInfoTxt, err)
+		return
+	}
+	var size int64
+	for _, n := range payload {
+		size += n
+	}
+	if octets != size || streams != int64(len(payload)) {
+		verr.add("%s: Payload-Oxum %d.%d does not match payload %d.%d",
+			bagInfoTxt, octets, streams, size, len(payload))
+	}
+}
+
+// payloadSizes returns the sizes of the payload files keyed by their path
+// relative to dir. It returns nil if the payload directory does not exist.
+func payloadSizes(dir string) (map[string]int64, error) {
+	root := filepath.Join(dir, dataDir)
+	if fi, err := os.Stat(root); os.IsNotExist(err) || (err == nil && !fi.IsDir()) {
+		return nil, nil
+	}
+
+	sizes := map[string]int64{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		rel, err := relPath(dir, path)
+		if err != nil {
+			return err
+		}
+		sizes[rel] = fi.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sizes, nil
+}
+
+// readManifests reads every manifest in dir with the given prefix. Parsing
+// errors and unsupported algorithms are recorded as validation problems.
+func readManifests(dir, prefix string, verr *ValidationError) (map[Algorithm]manifest, error) {
+	algs, err := manifestAlgorithms(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := make(map[Algorithm]manifest, len(algs))
+	for _, alg := range algs {
+		if _, err := alg.newHash(); err != nil {
+			verr.add("%s-%s.txt: %v", prefix, alg, err)
+			continue
+		}
+		m, err := readManifest(filepath.Join(dir, prefix+"-"+string(alg)+".txt"))
+		if err != nil {
+			verr.add("%v", err)
+			continue
+		}
+		manifests[alg] = m
+	}
+
+	return manifests, nil
+}
+
+// verifyFixity hashes every file listed in manifests once, computing all the
+// algorithms that list it, and records mismatching checksums.
+func verifyFixity(
+	ctx context.Context,
+	dir, prefix string,
+	manifests map[Algorithm]manifest,
+	verr *ValidationError,
+) error {
+	files := map[string][]Algorithm{}
+	for alg, m := range manifests {
+		for p := range m {
+			files[p] = append(files[p], alg)
+		}
+	}
+
+	for _, p := range slices.Sorted(maps.Keys(files)) {
+		path := filepath.Join(dir, filepath.FromSlash(p))
+		if !fsutil.FileExists(path) {
+			continue // Already reported as missing.
+		}
+
+		algs := files[p]
+		slices.Sort(algs)
+		sums, _, err := checksums(ctx, path, algs)
+		if err != nil {
+			return err
+		}
+		for _, alg := range algs {
+			if want := manifests[alg][p]; sums[alg] != want {
+				verr.add("%s-%s.txt: %s checksum mismatch: want %s, got %s", prefix, alg, p, want, sums[alg])
+			}
+		}
+	}
+
+	return nil
+}
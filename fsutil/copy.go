@@ -0,0 +1,287 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CopyMode determines how [Copy] copies regular files.
+type CopyMode int
+
+const (
+	// CopyAuto tries to reflink files, then copies their contents.
+	CopyAuto CopyMode = iota
+	// CopyReflink clones files, sharing their data blocks until either copy
+	// is modified, on file systems that support it, e.g. Btrfs, XFS or APFS.
+	// It fails on other file systems.
+	CopyReflink
+	// CopyHardlink hard links files, which fails across file systems.
+	CopyHardlink
+	// CopyBytes copies the contents of files.
+	CopyBytes
+	// CopyAutoHardlink tries to reflink files, then to hard link them, then
+	// copies their contents. Hard linked copies share their contents and
+	// metadata with the source, so CopyAutoHardlink is meant for copies
+	// whose source is removed afterwards, like in [MoveWithOptions], or
+	// never modified.
+	CopyAutoHardlink
+)
+
+func (m CopyMode) String() string {
+	switch m {
+	case CopyAuto:
+		return "auto"
+	case CopyReflink:
+		return "reflink"
+	case CopyHardlink:
+		return "hardlink"
+	case CopyBytes:
+		return "bytes"
+	case CopyAutoHardlink:
+		return "auto-hardlink"
+	}
+	return fmt.Sprintf("CopyMode(%d)", int(m))
+}
+
+// Preserve is a set of file metadata that must be preserved by [Copy].
+type Preserve int
+
+const (
+	// PreserveTimes preserves access and modification times.
+	PreserveTimes Preserve = 1 << iota
+	// PreserveXattrs preserves extended attributes.
+	PreserveXattrs
+	// PreserveOwner preserves the owner and group, which usually requires
+	// elevated privileges.
+	PreserveOwner
+
+	// PreserveAll preserves all the metadata above.
+	PreserveAll = PreserveTimes | PreserveXattrs | PreserveOwner
+)
+
+// CopyOptions configures [Copy].
+type CopyOptions struct {
+	// Mode determines how regular files are copied. Defaults to CopyAuto.
+	Mode CopyMode
+	// Sync commits the contents of files copied by bytes to stable storage.
+	Sync bool
+	// Preserve is the metadata that must be preserved: Copy fails if it
+	// can't preserve it, e.g. when the platform or the destination file
+	// system doesn't support extended attributes. Times and extended
+	// attributes that aren't required are preserved on a best-effort basis,
+	// ownership isn't.
+	Preserve Preserve
+}
+
+// Copy copies the file or directory src to dst, which must not exist.
+// Directories are copied recursively and symbolic links are copied as links.
+// Permission bits are preserved, as is the metadata required by
+// opts.Preserve, while access and modification times and extended attributes
+// are otherwise preserved on a best-effort basis. Only the owner of symbolic
+// links is preserved, when required. Other special files, e.g. named pipes, aren't
+// supported.
+//
+// Copy fails with an error wrapping [errors.ErrUnsupported] when opts.Mode is
+// CopyReflink or CopyHardlink and the file system doesn't support it.
+func Copy(src, dst string, opts CopyOptions) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("copy: %v", err)
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return errors.New("copy: destination already exists")
+	}
+
+	if err := copyEntry(src, dst, fi, opts); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+
+	return nil
+}
+
+// copyEntry copies src, whose info is fi, to dst.
+func copyEntry(src, dst string, fi fs.FileInfo, opts CopyOptions) error {
+	switch {
+	case fi.IsDir():
+		return copyDir(src, dst, fi, opts)
+	case fi.Mode()&fs.ModeSymlink != 0:
+		return copySymlink(src, dst, fi, opts.Preserve)
+	case fi.Mode().IsRegular():
+		return copyFile(src, dst, fi, opts)
+	}
+
+	return fmt.Errorf("%s: unsupported file type %s", src, fi.Mode().Type())
+}
+
+func copyDir(src, dst string, fi fs.FileInfo, opts CopyOptions) error {
+	// Make sure the directory is writable while its entries are copied.
+	if err := os.Mkdir(dst, 0o700); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		efi, err := e.Info()
+		if err != nil {
+			return err
+		}
+		if err := copyEntry(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name()), efi, opts); err != nil {
+			return err
+		}
+	}
+
+	// Times are preserved last as copying entries modifies them.
+	return copyMetadata(src, dst, fi, opts.Preserve)
+}
+
+// copySymlink copies the symbolic link src, whose info is fi, to dst,
+// preserving its owner if required by preserve.
+func copySymlink(src, dst string, fi fs.FileInfo, preserve Preserve) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(target, dst); err != nil {
+		return err
+	}
+	if preserve&PreserveOwner != 0 {
+		uid, gid, ok := fileOwner(fi)
+		if !ok {
+			return fmt.Errorf("preserve owner of %s: %w", src, errors.ErrUnsupported)
+		}
+		if err := os.Lchown(dst, uid, gid); err != nil {
+			return fmt.Errorf("preserve owner: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// copyFile copies the regular file src to dst using the methods allowed by
+// opts.Mode.
+func copyFile(src, dst string, fi fs.FileInfo, opts CopyOptions) error {
+	switch opts.Mode {
+	case CopyReflink:
+		return reflinkFile(src, dst, fi, opts.Preserve)
+	case CopyHardlink:
+		return hardlinkFile(src, dst)
+	case CopyBytes:
+		return copyFileBytes(src, dst, fi, opts)
+	}
+
+	// Every failure is a reason to fall back, as errors are platform and
+	// file system specific.
+	if err := reflinkFile(src, dst, fi, opts.Preserve); err == nil {
+		return nil
+	}
+	if opts.Mode == CopyAutoHardlink {
+		if err := hardlinkFile(src, dst); err == nil {
+			return nil
+		}
+	}
+	return copyFileBytes(src, dst, fi, opts)
+}
+
+// reflinkFile clones src to dst and preserves its metadata.
+func reflinkFile(src, dst string, fi fs.FileInfo, preserve Preserve) error {
+	if err := reflink(src, dst); err != nil {
+		return err
+	}
+	if err := copyMetadata(src, dst, fi, preserve); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+func hardlinkFile(src, dst string) error {
+	if err := os.Link(src, dst); err != nil {
+		return fmt.Errorf("%w: %v", errors.ErrUnsupported, err)
+	}
+	return nil
+}
+
+func copyFileBytes(src, dst string, fi fs.FileInfo, opts CopyOptions) (err error) {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	if opts.Sync {
+		if err := w.Sync(); err != nil {
+			return err
+		}
+	}
+
+	return copyMetadata(src, dst, fi, opts.Preserve)
+}
+
+// copyMetadata copies the permission bits, extended attributes, times and
+// optionally ownership of src, whose info is fi, to dst. It fails if metadata
+// required by preserve can't be copied.
+func copyMetadata(src, dst string, fi fs.FileInfo, preserve Preserve) error {
+	if preserve&PreserveOwner != 0 {
+		uid, gid, ok := fileOwner(fi)
+		if !ok {
+			return fmt.Errorf("preserve owner of %s: %w", src, errors.ErrUnsupported)
+		}
+		if err := os.Lchown(dst, uid, gid); err != nil {
+			return fmt.Errorf("preserve owner: %w", err)
+		}
+	}
+	if err := os.Chmod(dst, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := CopyXattrs(src, dst); err != nil && preserve&PreserveXattrs != 0 {
+		return fmt.Errorf("preserve extended attributes: %w", err)
+	}
+
+	atime, ok := FileAtime(fi)
+	if !ok {
+		if preserve&PreserveTimes != 0 {
+			return fmt.Errorf("preserve access time of %s: %w", src, errors.ErrUnsupported)
+		}
+		atime = time.Now()
+	}
+	return os.Chtimes(dst, atime, fi.ModTime())
+}
+
+// CopyTimes sets the access and modification times of the file dst to those
+// of the file src, following symbolic links. It fails with an error wrapping
+// [errors.ErrUnsupported] on platforms where access times aren't available.
+func CopyTimes(src, dst string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	atime, ok := FileAtime(fi)
+	if !ok {
+		return &os.PathError{Op: "copy times", Path: src, Err: errors.ErrUnsupported}
+	}
+	return os.Chtimes(dst, atime, fi.ModTime())
+}
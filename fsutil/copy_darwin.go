@@ -0,0 +1,30 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink clones the regular file src to dst, which must not exist, using
+// clonefile(2).
+func reflink(src, dst string) error {
+	if err := unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW); err != nil {
+		return fmt.Errorf("%w: reflink %s: %v", errors.ErrUnsupported, src, err)
+	}
+	return nil
+}
+
+// FileAtime returns the access time of fi, as returned by [os.Stat], reporting
+// whether it is available.
+func FileAtime(fi fs.FileInfo) (time.Time, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(st.Atimespec.Unix()), true
+}
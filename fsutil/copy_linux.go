@@ -0,0 +1,51 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink clones the regular file src to dst, which must not exist, using the
+// FICLONE ioctl.
+func reflink(src, dst string) (err error) {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	if err := unix.IoctlFileClone(int(w.Fd()), int(r.Fd())); err != nil {
+		return fmt.Errorf("%w: reflink %s: %v", errors.ErrUnsupported, src, err)
+	}
+
+	return nil
+}
+
+// FileAtime returns the access time of fi, as returned by [os.Stat], reporting
+// whether it is available.
+func FileAtime(fi fs.FileInfo) (time.Time, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(st.Atim.Unix()), true
+}
@@ -0,0 +1,20 @@
+//go:build !(linux || darwin)
+
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+)
+
+// reflink is not supported on this platform.
+func reflink(src, dst string) error {
+	return errors.ErrUnsupported
+}
+
+// FileAtime returns the access time of fi, which is not available on this
+// platform.
+func FileAtime(fi fs.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,156 @@
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	tfs "gotest.tools/v3/fs"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+func TestCopy(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	atime := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	newSrc := func(t *testing.T) *tfs.Dir {
+		td := tfs.NewDir(t, "enduro-test-fsutil",
+			tfs.WithDir("src", tfs.WithMode(0o750),
+				tfs.WithFile("a.txt", "a", tfs.WithMode(0o640)),
+				tfs.WithDir("objects", tfs.WithMode(0o700),
+					tfs.WithFile("b.txt", "bb", tfs.WithMode(0o600)),
+				),
+			),
+		)
+		if runtime.GOOS != "windows" {
+			assert.NilError(t, os.Symlink("a.txt", td.Join("src", "link")))
+		}
+		for _, name := range []string{"src/objects/b.txt", "src/objects", "src/a.txt", "src"} {
+			assert.NilError(t, os.Chtimes(td.Join(name), atime, mtime))
+		}
+		return td
+	}
+
+	for _, mode := range []fsutil.CopyMode{
+		fsutil.CopyAuto,
+		fsutil.CopyReflink,
+		fsutil.CopyHardlink,
+		fsutil.CopyBytes,
+		fsutil.CopyAutoHardlink,
+	} {
+		t.Run("Copies trees with mode "+mode.String(), func(t *testing.T) {
+			t.Parallel()
+
+			td := newSrc(t)
+			manifest := tfs.ManifestFromDir(t, td.Join("src"))
+
+			err := fsutil.Copy(td.Join("src"), td.Join("dst"), fsutil.CopyOptions{Mode: mode})
+			if mode == fsutil.CopyReflink && errors.Is(err, errors.ErrUnsupported) {
+				t.Skip("the file system doesn't support reflinks")
+			}
+			assert.NilError(t, err)
+			assert.Assert(t, tfs.Equal(td.Join("dst"), manifest))
+
+			for _, name := range []string{"dst/objects/b.txt", "dst/objects", "dst"} {
+				fi, err := os.Stat(td.Join(name))
+				assert.NilError(t, err)
+				assert.Assert(t, fi.ModTime().Equal(mtime), name)
+			}
+
+			src, err := os.Stat(td.Join("src", "a.txt"))
+			assert.NilError(t, err)
+			dst, err := os.Stat(td.Join("dst", "a.txt"))
+			assert.NilError(t, err)
+			if mode != fsutil.CopyAutoHardlink {
+				assert.Equal(t, os.SameFile(src, dst), mode == fsutil.CopyHardlink)
+			}
+		})
+	}
+
+	t.Run("Doesn't share files with the source by default", func(t *testing.T) {
+		t.Parallel()
+
+		td := newSrc(t)
+
+		err := fsutil.Copy(td.Join("src", "a.txt"), td.Join("a.txt"), fsutil.CopyOptions{})
+		assert.NilError(t, err)
+		assert.NilError(t, os.WriteFile(td.Join("a.txt"), []byte("changed"), 0o644))
+
+		b, err := os.ReadFile(td.Join("src", "a.txt"))
+		assert.NilError(t, err)
+		assert.Assert(t, string(b) != "changed")
+	})
+
+	t.Run("Fails if destination already exists", func(t *testing.T) {
+		t.Parallel()
+
+		td := newSrc(t)
+		assert.NilError(t, os.Mkdir(td.Join("dst"), 0o755))
+
+		err := fsutil.Copy(td.Join("src"), td.Join("dst"), fsutil.CopyOptions{})
+		assert.Error(t, err, "copy: destination already exists")
+	})
+
+	t.Run("Copies files", func(t *testing.T) {
+		t.Parallel()
+
+		td := newSrc(t)
+		err := fsutil.Copy(td.Join("src", "a.txt"), td.Join("a.txt"), fsutil.CopyOptions{Mode: fsutil.CopyBytes})
+		assert.NilError(t, err)
+
+		fi, err := os.Stat(td.Join("a.txt"))
+		assert.NilError(t, err)
+		assert.Equal(t, fi.Mode(), fs.FileMode(0o640))
+		assert.Assert(t, fi.ModTime().Equal(mtime))
+	})
+
+	t.Run("Preserves required metadata", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+			t.Skip("metadata can't be preserved on " + runtime.GOOS)
+		}
+
+		td := newSrc(t)
+		setXattr(t, td.Join("src", "a.txt"), "user.checksum", "abc")
+		assert.NilError(t, os.Chtimes(td.Join("src", "a.txt"), atime, mtime))
+
+		err := fsutil.Copy(td.Join("src"), td.Join("dst"), fsutil.CopyOptions{
+			Mode:     fsutil.CopyBytes,
+			Preserve: fsutil.PreserveAll,
+		})
+		assert.NilError(t, err)
+
+		value, err := fsutil.GetXattr(td.Join("dst", "a.txt"), "user.checksum")
+		assert.NilError(t, err)
+		assert.Equal(t, string(value), "abc")
+
+		fi, err := os.Stat(td.Join("dst", "a.txt"))
+		assert.NilError(t, err)
+		got, ok := fsutil.FileAtime(fi)
+		assert.Assert(t, ok)
+		assert.Assert(t, got.Equal(atime))
+	})
+
+	t.Run("Fails when required metadata can't be preserved", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+			t.Skip("metadata can be preserved on " + runtime.GOOS)
+		}
+
+		td := newSrc(t)
+		err := fsutil.Copy(td.Join("src"), td.Join("dst"), fsutil.CopyOptions{
+			Mode:     fsutil.CopyBytes,
+			Preserve: fsutil.PreserveXattrs,
+		})
+		assert.ErrorIs(t, err, errors.ErrUnsupported)
+	})
+}
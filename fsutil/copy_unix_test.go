@@ -0,0 +1,36 @@
+//go:build unix
+
+package fsutil_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	tfs "gotest.tools/v3/fs"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+func TestCopySymlinkOwner(t *testing.T) {
+	t.Parallel()
+
+	if os.Geteuid() != 0 {
+		t.Skip("changing owners requires root")
+	}
+
+	td := tfs.NewDir(t, "enduro-test-fsutil", tfs.WithSymlink("link", "a.txt"))
+	assert.NilError(t, os.Lchown(td.Join("link"), 1234, 1234))
+
+	err := fsutil.Copy(td.Join("link"), td.Join("copy"), fsutil.CopyOptions{
+		Preserve: fsutil.PreserveOwner,
+	})
+	assert.NilError(t, err)
+
+	fi, err := os.Lstat(td.Join("copy"))
+	assert.NilError(t, err)
+	st := fi.Sys().(*syscall.Stat_t)
+	assert.Equal(t, st.Uid, uint32(1234))
+	assert.Equal(t, st.Gid, uint32(1234))
+}
@@ -0,0 +1,342 @@
+package fsutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ChangeKind is the kind of a [TreeChange].
+type ChangeKind int
+
+const (
+	// ChangeAdded is an entry that only exists in the new tree.
+	ChangeAdded ChangeKind = iota + 1
+	// ChangeRemoved is an entry that only exists in the old tree.
+	ChangeRemoved
+	// ChangeModified is a file whose contents differ, or an entry that
+	// changed from a file to a directory or vice versa.
+	ChangeModified
+	// ChangeMode is an entry whose permission bits differ.
+	ChangeMode
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	case ChangeMode:
+		return "mode changed"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// TreeChange is a difference between two trees.
+type TreeChange struct {
+	// Path is the slash-separated path of the entry relative to the roots.
+	Path string
+	Kind ChangeKind
+	// IsDir is true when the entry is a directory in the new tree, or in the
+	// old tree for removed entries.
+	IsDir bool
+}
+
+func (c TreeChange) String() string {
+	return c.Kind.String() + ": " + c.Path
+}
+
+// DiffOptions configures [DiffTrees].
+type DiffOptions struct {
+	// Checksum compares the contents of files of equal size using SHA-256
+	// instead of comparing their modification times.
+	Checksum bool
+}
+
+// DiffTrees returns the changes that turn the tree oldFS into the tree newFS,
+// sorted by path. An entry that is both modified and has a different mode is
+// reported twice, modifications first.
+//
+// Files are modified when their sizes differ or, unless opts.Checksum is set,
+// when their modification times differ. Modification times are compared to
+// the second, as file systems store them at different precisions. Directories
+// are only compared by their permission bits.
+//
+// Use [os.DirFS] or [DirFS] to compare directories of the OS file system, and
+// [fs.Sub] to compare subdirectories.
+func DiffTrees(oldFS, newFS fs.FS, opts DiffOptions) ([]TreeChange, error) {
+	oldEntries, err := treeEntries(oldFS)
+	if err != nil {
+		return nil, fmt.Errorf("diff trees: %v", err)
+	}
+	newEntries, err := treeEntries(newFS)
+	if err != nil {
+		return nil, fmt.Errorf("diff trees: %v", err)
+	}
+
+	var changes []TreeChange
+	for name, nfi := range newEntries {
+		ofi, ok := oldEntries[name]
+		if !ok {
+			changes = append(changes, TreeChange{Path: name, Kind: ChangeAdded, IsDir: nfi.IsDir()})
+			continue
+		}
+
+		modified, err := entryModified(oldFS, newFS, name, ofi, nfi, opts)
+		if err != nil {
+			return nil, fmt.Errorf("diff trees: %v", err)
+		}
+		if modified {
+			changes = append(changes, TreeChange{Path: name, Kind: ChangeModified, IsDir: nfi.IsDir()})
+		}
+		if ofi.IsDir() == nfi.IsDir() && ofi.Mode().Perm() != nfi.Mode().Perm() {
+			changes = append(changes, TreeChange{Path: name, Kind: ChangeMode, IsDir: nfi.IsDir()})
+		}
+	}
+	for name, ofi := range oldEntries {
+		if _, ok := newEntries[name]; !ok {
+			changes = append(changes, TreeChange{Path: name, Kind: ChangeRemoved, IsDir: ofi.IsDir()})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b TreeChange) int {
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return int(a.Kind) - int(b.Kind)
+	})
+
+	return changes, nil
+}
+
+// treeEntries returns the info of every entry of fsys but its root.
+func treeEntries(fsys fs.FS) (map[string]fs.FileInfo, error) {
+	entries := map[string]fs.FileInfo{}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries[name] = fi
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// entryModified reports whether the entry name has been modified.
+func entryModified(oldFS, newFS fs.FS, name string, ofi, nfi fs.FileInfo, opts DiffOptions) (bool, error) {
+	switch {
+	case ofi.Mode().Type() != nfi.Mode().Type():
+		return true, nil
+	case ofi.IsDir():
+		return false, nil
+	case ofi.Size() != nfi.Size():
+		return true, nil
+	case !opts.Checksum:
+		return !ofi.ModTime().Truncate(time.Second).Equal(nfi.ModTime().Truncate(time.Second)), nil
+	case !ofi.Mode().IsRegular():
+		return false, nil
+	}
+
+	oldSum, err := fileSHA256(oldFS, name)
+	if err != nil {
+		return false, err
+	}
+	newSum, err := fileSHA256(newFS, name)
+	if err != nil {
+		return false, err
+	}
+
+	return !bytes.Equal(oldSum, newSum), nil
+}
+
+func fileSHA256(fsys fs.FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// SyncOptions configures [Sync].
+type SyncOptions struct {
+	// Checksum compares files like [DiffOptions].Checksum.
+	Checksum bool
+	// Delete removes the entries of the destination that don't exist in the
+	// source.
+	Delete bool
+	// DryRun reports the changes without applying them.
+	DryRun bool
+}
+
+// Sync makes the tree dst match the tree src, like a minimal rsync: entries
+// are created or replaced when added or modified, modes are updated and,
+// with opts.Delete, extra entries are removed. Modification times of files
+// are preserved when dst implements [ChtimesFS]. Only regular files and
+// directories are supported.
+//
+// It returns the changes applied, or that would be applied when opts.DryRun is
+// set, as reported by [DiffTrees] from dst to src.
+func Sync(dst WritableFS, src fs.FS, opts SyncOptions) ([]TreeChange, error) {
+	diff, err := DiffTrees(dst, src, DiffOptions{Checksum: opts.Checksum})
+	if err != nil {
+		return nil, fmt.Errorf("sync: %v", err)
+	}
+
+	var changes []TreeChange
+	for _, c := range diff {
+		if c.Kind == ChangeRemoved && !opts.Delete {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	if opts.DryRun {
+		return changes, nil
+	}
+
+	// Directory modes are applied last, deepest first, so read-only
+	// directories don't prevent creating their entries.
+	// Entries under a removed or replaced path are already gone, removing
+	// them again would fail when their parent is now a file.
+	var dirs []string
+	gone := map[string]bool{}
+	for _, c := range changes {
+		if c.IsDir && c.Kind != ChangeRemoved {
+			dirs = append(dirs, c.Path)
+		}
+		if c.IsDir && c.Kind == ChangeMode {
+			continue
+		}
+		if c.Kind == ChangeRemoved && underAny(gone, c.Path) {
+			continue
+		}
+		if c.Kind == ChangeRemoved || c.Kind == ChangeModified {
+			gone[c.Path] = true
+		}
+		if err := applyTreeChange(dst, src, c); err != nil {
+			return changes, fmt.Errorf("sync: %v", err)
+		}
+	}
+	for _, name := range slices.Backward(dirs) {
+		fi, err := fs.Stat(src, name)
+		if err != nil {
+			return changes, fmt.Errorf("sync: %v", err)
+		}
+		if err := dst.Chmod(name, fi.Mode().Perm()); err != nil {
+			return changes, fmt.Errorf("sync: %v", err)
+		}
+	}
+
+	return changes, nil
+}
+
+// underAny reports whether one of the parents of name is in paths.
+func underAny(paths map[string]bool, name string) bool {
+	for d := path.Dir(name); d != "."; d = path.Dir(d) {
+		if paths[d] {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTreeChange applies the change c from src to dst, except for the modes
+// of directories. Changes must be applied in path order so parents are
+// created before their entries.
+func applyTreeChange(dst WritableFS, src fs.FS, c TreeChange) error {
+	if c.Kind == ChangeRemoved {
+		return dst.RemoveAll(c.Path)
+	}
+
+	fi, err := fs.Stat(src, c.Path)
+	if err != nil {
+		return err
+	}
+	if c.Kind == ChangeMode {
+		return dst.Chmod(c.Path, fi.Mode().Perm())
+	}
+
+	if c.Kind == ChangeModified {
+		if dfi, err := dst.Stat(c.Path); err == nil && dfi.IsDir() != fi.IsDir() {
+			if err := dst.RemoveAll(c.Path); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch {
+	case fi.IsDir():
+		return dst.MkdirAll(c.Path, 0o700)
+	case fi.Mode().IsRegular():
+		if err := syncFile(dst, src, c.Path); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%s: unsupported file type %s", c.Path, fi.Mode().Type())
+	}
+	if err := dst.Chmod(c.Path, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if cfs, ok := dst.(ChtimesFS); ok {
+		return cfs.Chtimes(c.Path, fi.ModTime(), fi.ModTime())
+	}
+
+	return nil
+}
+
+// syncFile copies the file name from src to dst, writing to a temporary file
+// renamed into place so dst never holds a partial file.
+func syncFile(dst WritableFS, src fs.FS, name string) (err error) {
+	r, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tmp := path.Join(path.Dir(name), "."+path.Base(name)+".sync")
+	w, err := dst.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.Remove(tmp)
+		}
+	}()
+
+	_, err = io.Copy(w, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return dst.Rename(tmp, name)
+}
@@ -0,0 +1,188 @@
+package fsutil_test
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	tfs "gotest.tools/v3/fs"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+var treeModTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// newTree returns a MemFS holding files, with a fixed modification time.
+func newTree(t *testing.T, files map[string]string) *fsutil.MemFS {
+	t.Helper()
+
+	fsys := fsutil.NewMemFS()
+	for name, data := range files {
+		writeFile(t, fsys, name, data)
+		assert.NilError(t, fsys.Chtimes(name, treeModTime, treeModTime))
+	}
+	return fsys
+}
+
+func TestDiffTrees(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Reports changes", func(t *testing.T) {
+		t.Parallel()
+
+		oldFS := newTree(t, map[string]string{
+			"same.txt":        "same",
+			"size.txt":        "a",
+			"mtime.txt":       "b",
+			"mode.txt":        "c",
+			"removed/old.txt": "d",
+			"type":            "e",
+		})
+		newFS := newTree(t, map[string]string{
+			"same.txt":      "same",
+			"size.txt":      "aa",
+			"mtime.txt":     "b",
+			"mode.txt":      "c",
+			"added/new.txt": "f",
+			"type/file.txt": "g",
+		})
+		later := treeModTime.Add(time.Minute)
+		assert.NilError(t, newFS.Chtimes("mtime.txt", later, later))
+		assert.NilError(t, newFS.Chmod("mode.txt", 0o600))
+
+		changes, err := fsutil.DiffTrees(oldFS, newFS, fsutil.DiffOptions{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, changes, []fsutil.TreeChange{
+			{Path: "added", Kind: fsutil.ChangeAdded, IsDir: true},
+			{Path: "added/new.txt", Kind: fsutil.ChangeAdded},
+			{Path: "mode.txt", Kind: fsutil.ChangeMode},
+			{Path: "mtime.txt", Kind: fsutil.ChangeModified},
+			{Path: "removed", Kind: fsutil.ChangeRemoved, IsDir: true},
+			{Path: "removed/old.txt", Kind: fsutil.ChangeRemoved},
+			{Path: "size.txt", Kind: fsutil.ChangeModified},
+			{Path: "type", Kind: fsutil.ChangeModified, IsDir: true},
+			{Path: "type/file.txt", Kind: fsutil.ChangeAdded},
+		})
+		assert.Equal(t, changes[2].String(), "mode changed: mode.txt")
+	})
+
+	t.Run("Compares checksums", func(t *testing.T) {
+		t.Parallel()
+
+		oldFS := newTree(t, map[string]string{"a.txt": "abc", "b.txt": "abc"})
+		newFS := newTree(t, map[string]string{"a.txt": "abc", "b.txt": "xyz"})
+		later := treeModTime.Add(time.Minute)
+		assert.NilError(t, newFS.Chtimes("a.txt", later, later))
+
+		changes, err := fsutil.DiffTrees(oldFS, newFS, fsutil.DiffOptions{Checksum: true})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, changes, []fsutil.TreeChange{
+			{Path: "b.txt", Kind: fsutil.ChangeModified},
+		})
+	})
+}
+
+func TestSync(t *testing.T) {
+	t.Parallel()
+
+	newSrc := func(t *testing.T) *tfs.Dir {
+		return tfs.NewDir(t, "enduro-test-fsutil",
+			tfs.WithFile("a.txt", "a", tfs.WithMode(0o644)),
+			tfs.WithDir("objects", tfs.WithMode(0o755),
+				tfs.WithFile("b.txt", "bb", tfs.WithMode(0o600)),
+			),
+			tfs.WithDir("readonly", tfs.WithMode(0o555),
+				tfs.WithFile("c.txt", "ccc", tfs.WithMode(0o444)),
+			),
+		)
+	}
+
+	t.Run("Makes the destination match the source", func(t *testing.T) {
+		t.Parallel()
+
+		src := newSrc(t)
+		t.Cleanup(func() { os.Chmod(src.Join("readonly"), 0o755) })
+		dst := newTree(t, map[string]string{
+			"a.txt":         "old",
+			"extra/d.txt":   "d",
+			"objects/b.txt": "bb",
+		})
+
+		changes, err := fsutil.Sync(dst, os.DirFS(src.Path()), fsutil.SyncOptions{Delete: true})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, changes, []fsutil.TreeChange{
+			{Path: "a.txt", Kind: fsutil.ChangeModified},
+			{Path: "extra", Kind: fsutil.ChangeRemoved, IsDir: true},
+			{Path: "extra/d.txt", Kind: fsutil.ChangeRemoved},
+			{Path: "objects/b.txt", Kind: fsutil.ChangeModified},
+			{Path: "objects/b.txt", Kind: fsutil.ChangeMode},
+			{Path: "readonly", Kind: fsutil.ChangeAdded, IsDir: true},
+			{Path: "readonly/c.txt", Kind: fsutil.ChangeAdded},
+		})
+
+		changes, err = fsutil.DiffTrees(dst, os.DirFS(src.Path()), fsutil.DiffOptions{})
+		assert.NilError(t, err)
+		assert.Equal(t, len(changes), 0)
+
+		fi, err := dst.Stat("readonly")
+		assert.NilError(t, err)
+		assert.Equal(t, fi.Mode(), fs.ModeDir|0o555)
+	})
+
+	t.Run("Keeps extra entries without delete", func(t *testing.T) {
+		t.Parallel()
+
+		src := newSrc(t)
+		t.Cleanup(func() { os.Chmod(src.Join("readonly"), 0o755) })
+		dst := tfs.NewDir(t, "enduro-test-fsutil", tfs.WithFile("extra.txt", "e"))
+
+		changes, err := fsutil.Sync(fsutil.DirFS(dst.Path()), os.DirFS(src.Path()), fsutil.SyncOptions{})
+		assert.NilError(t, err)
+		assert.Equal(t, len(changes), 5)
+		assert.Assert(t, fsutil.FileExists(dst.Join("extra.txt")))
+		t.Cleanup(func() { os.Chmod(dst.Join("readonly"), 0o755) })
+
+		changes, err = fsutil.DiffTrees(os.DirFS(dst.Path()), os.DirFS(src.Path()), fsutil.DiffOptions{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, changes, []fsutil.TreeChange{
+			{Path: "extra.txt", Kind: fsutil.ChangeRemoved},
+		})
+	})
+
+	t.Run("Replaces directories with files", func(t *testing.T) {
+		t.Parallel()
+
+		src := tfs.NewDir(t, "enduro-test-fsutil", tfs.WithFile("x", "x"))
+		dst := tfs.NewDir(t, "enduro-test-fsutil",
+			tfs.WithDir("x", tfs.WithDir("child", tfs.WithFile("d.txt", "d"))),
+		)
+
+		changes, err := fsutil.Sync(fsutil.DirFS(dst.Path()), os.DirFS(src.Path()), fsutil.SyncOptions{Delete: true})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, changes, []fsutil.TreeChange{
+			{Path: "x", Kind: fsutil.ChangeModified},
+			{Path: "x/child", Kind: fsutil.ChangeRemoved, IsDir: true},
+			{Path: "x/child/d.txt", Kind: fsutil.ChangeRemoved},
+		})
+
+		b, err := os.ReadFile(dst.Join("x"))
+		assert.NilError(t, err)
+		assert.Equal(t, string(b), "x")
+	})
+
+	t.Run("Reports changes without applying them in a dry run", func(t *testing.T) {
+		t.Parallel()
+
+		src := newSrc(t)
+		t.Cleanup(func() { os.Chmod(src.Join("readonly"), 0o755) })
+		dst := newTree(t, map[string]string{"extra.txt": "e"})
+
+		changes, err := fsutil.Sync(dst, os.DirFS(src.Path()), fsutil.SyncOptions{Delete: true, DryRun: true})
+		assert.NilError(t, err)
+		assert.Equal(t, len(changes), 6)
+		assert.Assert(t, fsutil.FileExistsFS(dst, "extra.txt"))
+		assert.Assert(t, !fsutil.FileExistsFS(dst, "a.txt"))
+	})
+}
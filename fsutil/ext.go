@@ -0,0 +1,128 @@
+package fsutil
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// compoundExts is the registry of multi-part extensions used by
+// BaseNoCompoundExt, sorted from longest to shortest.
+var compoundExts = struct {
+	sync.RWMutex
+	exts []string
+}{
+	exts: []string{
+		".mets.xml",
+		".tar.bz2",
+		".tar.zst",
+		".tar.gz",
+		".tar.xz",
+	},
+}
+
+// RegisterCompoundExt registers multi-part extensions, e.g. ".warc.gz", to be
+// removed as a whole by [BaseNoCompoundExt]. Extensions must start with a
+// period and are matched case-insensitively. The registry initially holds
+// ".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst" and ".mets.xml".
+func RegisterCompoundExt(exts ...string) {
+	compoundExts.Lock()
+	defer compoundExts.Unlock()
+
+	for _, ext := range exts {
+		if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+			continue
+		}
+		if slices.ContainsFunc(compoundExts.exts, func(e string) bool { return strings.EqualFold(e, ext) }) {
+			continue
+		}
+		compoundExts.exts = append(compoundExts.exts, ext)
+	}
+	slices.SortStableFunc(compoundExts.exts, func(a, b string) int { return len(b) - len(a) })
+}
+
+// SplitExt splits the last element of path into its base name and the list of
+// its extensions, each with its leading period, e.g. "archive.tar.gz" is split
+// into "archive" and [".tar", ".gz"]. Leading periods are part of the base
+// name, so dotfiles such as ".bashrc" have no extension. Like [BaseNoExt],
+// "." and ".." are returned unaltered.
+func SplitExt(path string) (string, []string) {
+	base := filepath.Base(path)
+	if base == "." || base == ".." {
+		return base, nil
+	}
+
+	i := extStart(base)
+	if i < 0 {
+		return base, nil
+	}
+
+	var exts []string
+	rest := base[i:]
+	for rest != "" {
+		next := strings.IndexByte(rest[1:], '.')
+		if next < 0 {
+			exts = append(exts, rest)
+			break
+		}
+		exts = append(exts, rest[:next+1])
+		rest = rest[next+1:]
+	}
+
+	return base[:i], exts
+}
+
+// BaseNoLastExt returns the last element of path with only its last extension
+// removed, e.g. "report.v2.pdf" becomes "report.v2". Dotfiles such as
+// ".bashrc" are returned unaltered.
+func BaseNoLastExt(path string) string {
+	base := filepath.Base(path)
+	if base == "." || base == ".." {
+		return base
+	}
+	if extStart(base) < 0 {
+		return base
+	}
+
+	return base[:strings.LastIndexByte(base, '.')]
+}
+
+// BaseNoCompoundExt returns the last element of path with a registered
+// compound extension removed, e.g. "aip.tar.gz" becomes "aip", or with only its
+// last extension removed when none matches, e.g. "report.v2.pdf" becomes
+// "report.v2". See [RegisterCompoundExt].
+func BaseNoCompoundExt(path string) string {
+	base := filepath.Base(path)
+	if base == "." || base == ".." {
+		return base
+	}
+
+	compoundExts.RLock()
+	defer compoundExts.RUnlock()
+
+	start := extStart(base)
+	for _, ext := range compoundExts.exts {
+		i := len(base) - len(ext)
+		if start >= 0 && i >= start && strings.EqualFold(base[i:], ext) {
+			return base[:i]
+		}
+	}
+
+	return BaseNoLastExt(base)
+}
+
+// extStart returns the index of the first period starting an extension in
+// name, ignoring leading periods, or -1 if name has no extension.
+func extStart(name string) int {
+	trimmed := strings.TrimLeft(name, ".")
+	if trimmed == "" {
+		return -1
+	}
+	i := strings.IndexByte(trimmed, '.')
+	if i < 0 {
+		return -1
+	}
+
+	return len(name) - len(trimmed) + i
+}
@@ -0,0 +1,125 @@
+package fsutil_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+func ExampleSplitExt() {
+	fmt.Println(fsutil.SplitExt("/home/dir/archive.tar.gz"))
+	fmt.Println(fsutil.SplitExt("/home/dir/.bashrc"))
+	// Output: archive [.tar .gz]
+	// .bashrc []
+}
+
+func ExampleBaseNoLastExt() {
+	fmt.Println(fsutil.BaseNoLastExt("/home/dir/report.v2.final.pdf"))
+	fmt.Println(fsutil.BaseNoLastExt("/home/dir/archive.tar.gz"))
+	// Output: report.v2.final
+	// archive.tar
+}
+
+func ExampleBaseNoCompoundExt() {
+	fmt.Println(fsutil.BaseNoCompoundExt("/home/dir/archive.tar.gz"))
+	fmt.Println(fsutil.BaseNoCompoundExt("/home/dir/report.v2.final.pdf"))
+	// Output: archive
+	// report.v2.final
+}
+
+func TestSplitExt(t *testing.T) {
+	t.Parallel()
+
+	type test struct {
+		name     string
+		path     string
+		wantBase string
+		wantExts []string
+	}
+
+	for _, tc := range []test{
+		{
+			name:     "Splits multiple extensions",
+			path:     filepath.Join("home", "dir", "report.v2.final.pdf"),
+			wantBase: "report",
+			wantExts: []string{".v2", ".final", ".pdf"},
+		},
+		{
+			name:     "Splits a name without extension",
+			path:     filepath.Join("home", "dir", "README"),
+			wantBase: "README",
+		},
+		{
+			name:     "Keeps the leading period of a dotfile",
+			path:     filepath.Join("home", "dir", ".config.json"),
+			wantBase: ".config",
+			wantExts: []string{".json"},
+		},
+		{
+			name:     "Splits a name with non-ASCII characters",
+			path:     filepath.Join("home", "dir", "résumé.ñandú.TXT"),
+			wantBase: "résumé",
+			wantExts: []string{".ñandú", ".TXT"},
+		},
+		{
+			name:     "Keeps a trailing period",
+			path:     filepath.Join("home", "dir", "file."),
+			wantBase: "file",
+			wantExts: []string{"."},
+		},
+		{
+			name:     "Returns a double period unaltered",
+			path:     "..",
+			wantBase: "..",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			base, exts := fsutil.SplitExt(tc.path)
+			assert.Equal(t, base, tc.wantBase)
+			assert.DeepEqual(t, exts, tc.wantExts)
+		})
+	}
+}
+
+func TestBaseNoLastExt(t *testing.T) {
+	t.Parallel()
+
+	for path, want := range map[string]string{
+		filepath.Join("home", "dir", "report.v2.final.pdf"): "report.v2.final",
+		filepath.Join("home", "dir", "README"):              "README",
+		filepath.Join("home", "dir", ".bashrc"):             ".bashrc",
+		filepath.Join("home", "dir", ".bashrc.bak"):         ".bashrc",
+		filepath.Join("home", "dir", "日本語.テキスト.txt"):        "日本語.テキスト",
+		string(filepath.Separator):                          string(filepath.Separator),
+		".":                                                 ".",
+		"..":                                                "..",
+	} {
+		assert.Equal(t, fsutil.BaseNoLastExt(path), want, path)
+	}
+}
+
+func TestBaseNoCompoundExt(t *testing.T) {
+	// This test isn't run in parallel because it modifies global state.
+	fsutil.RegisterCompoundExt(".warc.gz", "invalid", ".TAR.GZ")
+
+	for path, want := range map[string]string{
+		filepath.Join("home", "dir", "aip.tar.gz"):          "aip",
+		filepath.Join("home", "dir", "AIP.TAR.BZ2"):         "AIP",
+		filepath.Join("home", "dir", "aip.v1.tar.zst"):      "aip.v1",
+		filepath.Join("home", "dir", "METS.uuid.mets.xml"):  "METS.uuid",
+		filepath.Join("home", "dir", "crawl.warc.gz"):       "crawl",
+		filepath.Join("home", "dir", "report.v2.final.pdf"): "report.v2.final",
+		filepath.Join("home", "dir", "data.gz"):             "data",
+		filepath.Join("home", "dir", ".tar.gz"):             ".tar",
+		filepath.Join("home", "dir", "README"):              "README",
+		"..":                                                "..",
+	} {
+		assert.Equal(t, fsutil.BaseNoCompoundExt(path), want, path)
+	}
+}
@@ -0,0 +1,280 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WritableFS is a file system that can be modified. Like [fs.FS], names are
+// slash-separated paths, unrooted and without "." or ".." elements, see
+// [fs.ValidPath].
+type WritableFS interface {
+	fs.StatFS
+
+	// Create creates or truncates the named file, whose parent directory
+	// must exist, and opens it for writing.
+	Create(name string) (io.WriteCloser, error)
+	// MkdirAll creates the named directory along with any missing parents.
+	MkdirAll(name string, perm fs.FileMode) error
+	// Rename renames oldname to newname, replacing newname if it's a file.
+	Rename(oldname, newname string) error
+	// Remove removes the named file or empty directory.
+	Remove(name string) error
+	// RemoveAll removes name and anything it contains. It returns nil if name
+	// doesn't exist.
+	RemoveAll(name string) error
+	// Chmod changes the permission bits of the named file.
+	Chmod(name string, mode fs.FileMode) error
+}
+
+// ChtimesFS is a WritableFS that can change the access and modification times
+// of files.
+type ChtimesFS interface {
+	WritableFS
+
+	// Chtimes changes the access and modification times of the named file.
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// dirFS is a WritableFS for a directory tree of the OS file system.
+type dirFS string
+
+var _ ChtimesFS = dirFS("")
+
+// DirFS returns a [WritableFS] for the tree of files rooted at the directory
+// dir. Like [os.DirFS], it doesn't prevent symbolic links from referring to
+// files outside dir.
+func DirFS(dir string) WritableFS {
+	return dirFS(dir)
+}
+
+// join returns the OS path of name, or an error if name isn't valid.
+func (dir dirFS) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) || runtime.GOOS == "windows" && strings.ContainsAny(name, `\:`) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(string(dir), filepath.FromSlash(name)), nil
+}
+
+func (dir dirFS) Open(name string) (fs.File, error) {
+	p, err := dir.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (dir dirFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := dir.join("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+func (dir dirFS) Create(name string) (io.WriteCloser, error) {
+	p, err := dir.join("create", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Create(p)
+}
+
+func (dir dirFS) MkdirAll(name string, perm fs.FileMode) error {
+	p, err := dir.join("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, perm)
+}
+
+func (dir dirFS) Rename(oldname, newname string) error {
+	oldpath, err := dir.join("rename", oldname)
+	if err != nil {
+		return err
+	}
+	newpath, err := dir.join("rename", newname)
+	if err != nil {
+		return err
+	}
+	return renamer(oldpath, newpath)
+}
+
+func (dir dirFS) Remove(name string) error {
+	p, err := dir.join("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+func (dir dirFS) RemoveAll(name string) error {
+	p, err := dir.join("removeall", name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+func (dir dirFS) Chmod(name string, mode fs.FileMode) error {
+	p, err := dir.join("chmod", name)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(p, mode)
+}
+
+func (dir dirFS) Chtimes(name string, atime, mtime time.Time) error {
+	p, err := dir.join("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(p, atime, mtime)
+}
+
+// ExistsFS is like [Exists] for the named file in fsys.
+func ExistsFS(fsys fs.FS, name string) (bool, error) {
+	_, err := fs.Stat(fsys, name)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+// FileExistsFS is like [FileExists] for the named file in fsys.
+func FileExistsFS(fsys fs.FS, name string) bool {
+	exists, err := ExistsFS(fsys, name)
+	return err == nil && exists
+}
+
+// MoveFS is like [Move] for files in fsys. When renaming fails because src and
+// dst are on different devices, e.g. in a [DirFS] spanning mount points, src
+// is copied to dst then removed.
+func MoveFS(fsys WritableFS, src, dst string) error {
+	if _, err := fsys.Stat(dst); err == nil {
+		return errors.New("destination already exists")
+	}
+
+	// Rename when possible.
+	err := fsys.Rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+
+	// Copy and delete otherwise.
+	if err := copyFS(fsys, src, dst); err != nil {
+		return err
+	}
+	return fsys.RemoveAll(src)
+}
+
+// copyFS copies the file or directory tree src to dst, preserving permission
+// bits.
+func copyFS(fsys WritableFS, src, dst string) error {
+	// Directory modes are applied last, deepest first, so read-only
+	// directories don't prevent copying their entries.
+	type dirMode struct {
+		name string
+		mode fs.FileMode
+	}
+	var dirs []dirMode
+	err := fs.WalkDir(fsys, src, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := dst
+		if name != src {
+			target = path.Join(dst, strings.TrimPrefix(name, src+"/"))
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			dirs = append(dirs, dirMode{target, fi.Mode().Perm()})
+			return fsys.MkdirAll(target, 0o700)
+		case d.Type().IsRegular():
+			if err := copyFSFile(fsys, name, target); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("copy %s: unsupported file type %s", name, d.Type())
+		}
+
+		return fsys.Chmod(target, fi.Mode().Perm())
+	})
+	if err != nil {
+		return err
+	}
+	for _, d := range slices.Backward(dirs) {
+		if err := fsys.Chmod(d.name, d.mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyFSFile(fsys WritableFS, src, dst string) (err error) {
+	r, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := fsys.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// isCrossDevice reports whether err is a rename error caused by the source and
+// destination being on different file systems.
+func isCrossDevice(err error) bool {
+	var lerr *os.LinkError
+	return errors.As(err, &lerr) && lerr.Err.Error() == "invalid cross-device link"
+}
+
+// SetFileModesFS is like [SetFileModes] for the directory root in fsys.
+func SetFileModesFS(fsys WritableFS, root string, dirMode, fileMode fs.FileMode) error {
+	return fs.WalkDir(fsys, root,
+		func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			mode := fileMode
+			if d.IsDir() {
+				mode = dirMode
+			}
+
+			if err := fsys.Chmod(name, mode); err != nil {
+				return fmt.Errorf("set file mode: %v", err)
+			}
+
+			return nil
+		},
+	)
+}
@@ -0,0 +1,124 @@
+package fsutil_test
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+// writeFile writes a file to fsys, creating its parent directories.
+func writeFile(t *testing.T, fsys fsutil.WritableFS, name, data string) {
+	t.Helper()
+
+	assert.NilError(t, fsys.MkdirAll(path.Dir(name), 0o755))
+	w, err := fsys.Create(name)
+	assert.NilError(t, err)
+	_, err = io.WriteString(w, data)
+	assert.NilError(t, err)
+	assert.NilError(t, w.Close())
+}
+
+func TestWritableFS(t *testing.T) {
+	t.Parallel()
+
+	type test struct {
+		name  string
+		newFS func(t *testing.T) fsutil.WritableFS
+	}
+	for _, tc := range []test{
+		{
+			name:  "DirFS",
+			newFS: func(t *testing.T) fsutil.WritableFS { return fsutil.DirFS(t.TempDir()) },
+		},
+		{
+			name:  "MemFS",
+			newFS: func(t *testing.T) fsutil.WritableFS { return fsutil.NewMemFS() },
+		},
+	} {
+		t.Run(tc.name+" passes fstest", func(t *testing.T) {
+			t.Parallel()
+
+			fsys := tc.newFS(t)
+			writeFile(t, fsys, "a.txt", "a")
+			writeFile(t, fsys, "dir/b.txt", "bb")
+			writeFile(t, fsys, "dir/sub/c.txt", "ccc")
+			assert.NilError(t, fsys.MkdirAll("empty", 0o755))
+
+			assert.NilError(t, fstest.TestFS(fsys, "a.txt", "dir/b.txt", "dir/sub/c.txt", "empty"))
+		})
+
+		t.Run(tc.name+" modifies files", func(t *testing.T) {
+			t.Parallel()
+
+			fsys := tc.newFS(t)
+			writeFile(t, fsys, "dir/a.txt", "a")
+			writeFile(t, fsys, "dir/a.txt", "replaced")
+
+			data, err := fs.ReadFile(fsys, "dir/a.txt")
+			assert.NilError(t, err)
+			assert.Equal(t, string(data), "replaced")
+
+			_, err = fsys.Create("missing/a.txt")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+
+			assert.NilError(t, fsys.Chmod("dir/a.txt", 0o600))
+			fi, err := fsys.Stat("dir/a.txt")
+			assert.NilError(t, err)
+			assert.Equal(t, fi.Mode(), fs.FileMode(0o600))
+
+			assert.NilError(t, fsys.Rename("dir", "renamed"))
+			assert.Assert(t, !fsutil.FileExistsFS(fsys, "dir"))
+			assert.Assert(t, fsutil.FileExistsFS(fsys, "renamed/a.txt"))
+
+			assert.ErrorContains(t, fsys.Remove("renamed"), "not empty")
+			assert.NilError(t, fsys.Remove("renamed/a.txt"))
+			assert.NilError(t, fsys.Remove("renamed"))
+
+			writeFile(t, fsys, "tree/sub/a.txt", "a")
+			assert.NilError(t, fsys.RemoveAll("tree"))
+			assert.NilError(t, fsys.RemoveAll("tree"))
+			assert.Assert(t, !fsutil.FileExistsFS(fsys, "tree"))
+
+			_, err = fsys.Open("../escape")
+			assert.ErrorIs(t, err, fs.ErrInvalid)
+		})
+
+		t.Run(tc.name+" works with the fsutil helpers", func(t *testing.T) {
+			t.Parallel()
+
+			fsys := tc.newFS(t)
+			writeFile(t, fsys, "transfer/objects/a.txt", "a")
+			writeFile(t, fsys, "other.txt", "")
+
+			exists, err := fsutil.ExistsFS(fsys, "transfer/objects/a.txt")
+			assert.NilError(t, err)
+			assert.Equal(t, exists, true)
+			exists, err = fsutil.ExistsFS(fsys, "missing")
+			assert.NilError(t, err)
+			assert.Equal(t, exists, false)
+
+			assert.Error(t, fsutil.MoveFS(fsys, "transfer", "other.txt"), "destination already exists")
+			assert.NilError(t, fsutil.MoveFS(fsys, "transfer", "moved"))
+			data, err := fs.ReadFile(fsys, "moved/objects/a.txt")
+			assert.NilError(t, err)
+			assert.Equal(t, string(data), "a")
+
+			assert.NilError(t, fsutil.SetFileModesFS(fsys, "moved", 0o700, 0o600))
+			for name, mode := range map[string]fs.FileMode{
+				"moved":               fs.ModeDir | 0o700,
+				"moved/objects":       fs.ModeDir | 0o700,
+				"moved/objects/a.txt": 0o600,
+			} {
+				fi, err := fsys.Stat(name)
+				assert.NilError(t, err)
+				assert.Equal(t, fi.Mode(), mode, name)
+			}
+		})
+	}
+}
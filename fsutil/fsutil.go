@@ -2,21 +2,26 @@
 package fsutil
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/otiai10/copy"
 )
 
 // renamer sets the function for renaming a file, defaulting to os.Rename.
 // Changing renamer should only be done in tests.
 var renamer = os.Rename
 
-// BaseNoExt returns the last element of path with any file extensions removed.
+// freeSpace sets the function for querying free space, defaulting to
+// FreeSpace. Changing freeSpace should only be done in tests.
+var freeSpace = FreeSpace
+
+// BaseNoExt returns the last element of path with any file extensions removed,
+// i.e. everything from its first period. See [BaseNoLastExt] and
+// [BaseNoCompoundExt] to remove fewer extensions.
 func BaseNoExt(path string) string {
 	base := filepath.Base(path)
 	if base == "." || base == ".." {
@@ -51,8 +56,30 @@ func FileExists(path string) bool {
 
 // Move moves a file or directory. It first tries to rename src to dst. If the
 // rename fails due to the source and destination being on different file
-// systems Move copies src to dst, then deletes src.
+// systems Move copies src to dst with [Copy], then deletes src.
 func Move(src, dst string) error {
+	return MoveWithOptions(src, dst, MoveOptions{})
+}
+
+// MoveOptions configures [MoveWithOptions].
+type MoveOptions struct {
+	// CheckSpace makes a move across file systems fail with
+	// ErrInsufficientSpace, before copying anything, when the destination
+	// file system doesn't have enough free space for src.
+	CheckSpace bool
+	// CopyMode determines how files are copied across file systems, see
+	// [CopyOptions]. The default, CopyAuto, is replaced with
+	// CopyAutoHardlink as the source is removed after the copy; both fall
+	// back to copying bytes as reflinks and hard links don't work across
+	// file systems.
+	CopyMode CopyMode
+	// Preserve is the metadata that must be preserved when copying, see
+	// [CopyOptions].
+	Preserve Preserve
+}
+
+// MoveWithOptions moves a file or directory like [Move], configured by opts.
+func MoveWithOptions(src, dst string, opts MoveOptions) error {
 	if _, err := os.Stat(dst); err == nil {
 		return errors.New("destination already exists")
 	}
@@ -64,13 +91,17 @@ func Move(src, dst string) error {
 	}
 
 	// Copy and delete otherwise.
-	lerr, _ := err.(*os.LinkError)
-	if lerr.Err.Error() == "invalid cross-device link" {
-		err := copy.Copy(src, dst, copy.Options{
-			Sync:        true,
-			OnDirExists: func(src, dst string) copy.DirExistsAction { return copy.Untouchable },
-		})
-		if err != nil {
+	if isCrossDevice(err) {
+		if opts.CheckSpace {
+			if err := checkSpace(src, filepath.Dir(dst)); err != nil {
+				return err
+			}
+		}
+		mode := opts.CopyMode
+		if mode == CopyAuto {
+			mode = CopyAutoHardlink
+		}
+		if err := Copy(src, dst, CopyOptions{Mode: mode, Sync: true, Preserve: opts.Preserve}); err != nil {
 			return err
 		}
 		return os.RemoveAll(src)
@@ -79,8 +110,27 @@ func Move(src, dst string) error {
 	return err
 }
 
+// checkSpace returns an error wrapping ErrInsufficientSpace if the file system
+// of dir doesn't have enough free space to copy src.
+func checkSpace(src, dir string) error {
+	usage, err := DirUsage(context.Background(), src)
+	if err != nil {
+		return fmt.Errorf("check space: %v", err)
+	}
+	space, err := freeSpace(dir)
+	if err != nil {
+		return fmt.Errorf("check space: %v", err)
+	}
+	if uint64(usage.Size) > space.Free {
+		return fmt.Errorf("check space: %w: %d bytes needed, %d bytes available", ErrInsufficientSpace, usage.Size, space.Free)
+	}
+
+	return nil
+}
+
 // SetFileModes recursively sets the file mode of directory root and its
-// contents.
+// contents. It follows symbolic links and stops at the first error, use
+// [SetFileModesWithOptions] for finer control.
 func SetFileModes(root string, dirMode, fileMode fs.FileMode) error {
 	return filepath.WalkDir(root,
 		func(path string, d os.DirEntry, err error) error {
@@ -3,7 +3,10 @@ package fsutil
 import (
 	"errors"
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
 	"gotest.tools/v3/assert"
 	"gotest.tools/v3/fs"
@@ -107,3 +110,104 @@ func TestMove(t *testing.T) {
 		assert.Assert(t, fs.Equal(dst, srcManifest))
 	})
 }
+
+func TestMoveWithOptions(t *testing.T) {
+	// Subtests aren't run in parallel because they modify global state.
+	crossDevice := func(t *testing.T) {
+		renamer = func(src, dst string) error {
+			return &os.LinkError{
+				Op:  "rename",
+				Old: src,
+				New: dst,
+				Err: errors.New("invalid cross-device link"),
+			}
+		}
+		t.Cleanup(func() {
+			renamer = os.Rename
+		})
+	}
+
+	t.Run("It fails fast when space is insufficient", func(t *testing.T) {
+		crossDevice(t)
+		freeSpace = func(path string) (SpaceInfo, error) {
+			return SpaceInfo{Total: 10, Free: 5}, nil
+		}
+		t.Cleanup(func() {
+			freeSpace = FreeSpace
+		})
+
+		tmpSrc := fs.NewDir(t, "enduro", dirOpts...)
+		src := tmpSrc.Path()
+		dst := fs.NewDir(t, "enduro").Join("nested")
+
+		err := MoveWithOptions(src, dst, MoveOptions{CheckSpace: true})
+
+		assert.ErrorIs(t, err, ErrInsufficientSpace)
+		assert.Error(t, err, "check space: insufficient free space: 6 bytes needed, 5 bytes available")
+		_, err = os.Stat(dst)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.Assert(t, fs.Equal(src, fs.Expected(t, dirOpts...)))
+	})
+
+	t.Run("It copies directories when space is sufficient", func(t *testing.T) {
+		crossDevice(t)
+
+		tmpSrc := fs.NewDir(t, "enduro", dirOpts...)
+		src := tmpSrc.Path()
+		srcManifest := fs.ManifestFromDir(t, src)
+		dst := fs.NewDir(t, "enduro").Join("nested")
+
+		err := MoveWithOptions(src, dst, MoveOptions{CheckSpace: true})
+
+		assert.NilError(t, err)
+		_, err = os.Stat(src)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.Assert(t, fs.Equal(dst, srcManifest))
+	})
+
+	t.Run("It preserves required metadata", func(t *testing.T) {
+		crossDevice(t)
+
+		tmpSrc := fs.NewDir(t, "enduro", dirOpts...)
+		src := tmpSrc.Path()
+		mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		assert.NilError(t, os.Chtimes(tmpSrc.Join("child1", "foo.txt"), mtime, mtime))
+		dst := fs.NewDir(t, "enduro").Join("nested")
+
+		err := MoveWithOptions(src, dst, MoveOptions{CopyMode: CopyBytes, Preserve: PreserveTimes})
+		if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+			assert.ErrorIs(t, err, errors.ErrUnsupported)
+			return
+		}
+
+		assert.NilError(t, err)
+		fi, err := os.Stat(filepath.Join(dst, "child1", "foo.txt"))
+		assert.NilError(t, err)
+		assert.Assert(t, fi.ModTime().Equal(mtime))
+	})
+}
+
+func TestMoveFS(t *testing.T) {
+	// This test isn't run in parallel because it modifies global state.
+	renamer = func(src, dst string) error {
+		return &os.LinkError{
+			Op:  "rename",
+			Old: src,
+			New: dst,
+			Err: errors.New("invalid cross-device link"),
+		}
+	}
+	t.Cleanup(func() {
+		renamer = os.Rename
+	})
+
+	tmpDir := fs.NewDir(t, "enduro", fs.WithDir("src", dirOpts...))
+	srcManifest := fs.ManifestFromDir(t, tmpDir.Join("src"))
+
+	err := MoveFS(DirFS(tmpDir.Path()), "src", "dst")
+
+	assert.NilError(t, err)
+	_, err = os.Stat(tmpDir.Join("src"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Assert(t, fs.Equal(tmpDir.Join("dst"), srcManifest))
+}
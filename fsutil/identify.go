@@ -0,0 +1,264 @@
+package fsutil
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// identifyHeaderSize is the number of bytes read to identify a file.
+const identifyHeaderSize = 8192
+
+// Confidence is the confidence of a file format identification.
+type Confidence int
+
+const (
+	// ConfidenceNone means the format couldn't be identified.
+	ConfidenceNone Confidence = iota
+	// ConfidenceLow is a guess based on a heuristic or a short signature.
+	ConfidenceLow
+	// ConfidenceMedium is a signature match for a container shared by
+	// several formats, e.g. ZIP for Office documents.
+	ConfidenceMedium
+	// ConfidenceHigh is a match of a distinctive signature.
+	ConfidenceHigh
+)
+
+var confidenceNames = []string{"none", "low", "medium", "high"}
+
+func (c Confidence) String() string {
+	if c >= 0 && int(c) < len(confidenceNames) {
+		return confidenceNames[c]
+	}
+	return fmt.Sprintf("Confidence(%d)", int(c))
+}
+
+// Identification is a file format identified by [Identify].
+type Identification struct {
+	// Name of the format, e.g. "PDF".
+	Name string
+	// MIME type of the format, "application/octet-stream" when the format
+	// couldn't be identified.
+	MIME string
+	// Extensions commonly used by the format, lowercase, with their leading
+	// period.
+	Extensions []string
+	Confidence Confidence
+}
+
+// MatchesExt reports whether the extension of name is one of the extensions
+// of the format. It's always true when the format couldn't be identified.
+func (id Identification) MatchesExt(name string) bool {
+	if id.Confidence == ConfidenceNone {
+		return true
+	}
+	return slices.Contains(id.Extensions, strings.ToLower(path.Ext(name)))
+}
+
+var (
+	unknownFormat = Identification{Name: "Unknown", MIME: "application/octet-stream"}
+	textFormat    = Identification{
+		Name:       "Plain text",
+		MIME:       "text/plain",
+		Extensions: []string{".txt", ".csv", ".tsv", ".md", ".json", ".log"},
+		Confidence: ConfidenceLow,
+	}
+)
+
+// signature is a format signature of the embedded table.
+type signature struct {
+	Name       string   `json:"name"`
+	MIME       string   `json:"mime"`
+	Extensions []string `json:"extensions"`
+	Confidence string   `json:"confidence"`
+	Magic      []struct {
+		Offset int    `json:"offset"`
+		Text   string `json:"text"`
+		Hex    string `json:"hex"`
+	} `json:"magic"`
+
+	id       Identification
+	patterns []magicPattern
+}
+
+// magicPattern is a sequence of bytes found at an offset.
+type magicPattern struct {
+	offset int
+	data   []byte
+}
+
+//go:embed signatures.json
+var signaturesJSON []byte
+
+// signatures returns the embedded signature table, in matching order.
+var signatures = sync.OnceValue(func() []signature {
+	var sigs []signature
+	if err := json.Unmarshal(signaturesJSON, &sigs); err != nil {
+		panic("fsutil: invalid signature table: " + err.Error())
+	}
+
+	for i := range sigs {
+		s := &sigs[i]
+		s.id = Identification{
+			Name:       s.Name,
+			MIME:       s.MIME,
+			Extensions: s.Extensions,
+			Confidence: Confidence(slices.Index(confidenceNames, s.Confidence)),
+		}
+		if s.id.Confidence <= ConfidenceNone || len(s.Magic) == 0 {
+			panic("fsutil: invalid signature table entry: " + s.Name)
+		}
+		for _, m := range s.Magic {
+			data := []byte(m.Text)
+			if m.Hex != "" {
+				var err error
+				if data, err = hex.DecodeString(m.Hex); err != nil {
+					panic("fsutil: invalid signature table entry: " + s.Name)
+				}
+			}
+			s.patterns = append(s.patterns, magicPattern{offset: m.Offset, data: data})
+		}
+	}
+
+	return sigs
+})
+
+// Identify identifies the format of the data read from r by matching its first
+// bytes against an embedded table of signatures of common formats, e.g. PDF,
+// TIFF, JPEG, PNG, ZIP, TAR or XML. Data that doesn't match any signature but
+// looks like text is identified as plain text with a low confidence.
+// Otherwise the result has ConfidenceNone.
+func Identify(r io.Reader) (Identification, error) {
+	header := make([]byte, identifyHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return Identification{}, fmt.Errorf("identify: %v", err)
+	}
+
+	return identifyHeader(header[:n]), nil
+}
+
+func identifyHeader(header []byte) Identification {
+	for _, s := range signatures() {
+		if s.matches(header) {
+			return s.id
+		}
+	}
+	if looksLikeText(header) {
+		return textFormat
+	}
+	return unknownFormat
+}
+
+func (s signature) matches(header []byte) bool {
+	for _, p := range s.patterns {
+		end := p.offset + len(p.data)
+		if end > len(header) || !bytes.Equal(header[p.offset:end], p.data) {
+			return false
+		}
+	}
+	return true
+}
+
+// looksLikeText reports whether header is non-empty UTF-8 text without
+// control characters other than whitespace.
+func looksLikeText(header []byte) bool {
+	if len(header) == 0 {
+		return false
+	}
+	// Ignore a rune truncated by the header size.
+	if len(header) == identifyHeaderSize {
+		for i := 0; i < utf8.UTFMax && i < len(header); i++ {
+			if utf8.RuneStart(header[len(header)-1-i]) {
+				if !utf8.FullRune(header[len(header)-1-i:]) {
+					header = header[:len(header)-1-i]
+				}
+				break
+			}
+		}
+	}
+	if !utf8.Valid(header) {
+		return false
+	}
+	for _, b := range header {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' || b == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// IdentifyFile identifies the format of the file at path. See [Identify].
+func IdentifyFile(path string) (Identification, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Identification{}, fmt.Errorf("identify: %v", err)
+	}
+	defer f.Close()
+
+	return Identify(f)
+}
+
+// IdentifyFS identifies the format of the named file in fsys. See [Identify].
+func IdentifyFS(fsys fs.FS, name string) (Identification, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return Identification{}, fmt.Errorf("identify: %v", err)
+	}
+	defer f.Close()
+
+	return Identify(f)
+}
+
+// FileIdentification is the identification of a file found by [IdentifyTree].
+type FileIdentification struct {
+	// Path is the slash-separated path of the file in the tree.
+	Path string
+	Identification
+	// ExtMismatch is true when the format was identified with at least a
+	// medium confidence and the extension of the file isn't one of the
+	// format's extensions.
+	ExtMismatch bool
+}
+
+// IdentifyTree identifies every regular file of the tree fsys, e.g. returned
+// by [os.DirFS], in lexical order. Use ExtMismatch to report files whose
+// extension doesn't match their content.
+func IdentifyTree(fsys fs.FS) ([]FileIdentification, error) {
+	var ids []FileIdentification
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		id, err := IdentifyFS(fsys, name)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, FileIdentification{
+			Path:           name,
+			Identification: id,
+			ExtMismatch:    id.Confidence >= ConfidenceMedium && !id.MatchesExt(name),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return ids, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,126 @@
+package fsutil_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+	tfs "gotest.tools/v3/fs"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+// tarHeader returns the beginning of a tar archive.
+func tarHeader() string {
+	h := make([]byte, 512)
+	copy(h, "file.txt")
+	copy(h[257:], "ustar\x0000")
+	return string(h)
+}
+
+func TestIdentify(t *testing.T) {
+	t.Parallel()
+
+	type test struct {
+		name       string
+		data       string
+		mime       string
+		confidence fsutil.Confidence
+	}
+	for _, tc := range []test{
+		{name: "PDF", data: "%PDF-1.7\n%\xe2\xe3\xcf\xd3\n", mime: "application/pdf", confidence: fsutil.ConfidenceHigh},
+		{name: "PNG", data: "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", mime: "image/png", confidence: fsutil.ConfidenceHigh},
+		{name: "JPEG", data: "\xff\xd8\xff\xe0\x00\x10JFIF", mime: "image/jpeg", confidence: fsutil.ConfidenceHigh},
+		{name: "TIFF", data: "MM\x00*\x00\x00\x00\x08", mime: "image/tiff", confidence: fsutil.ConfidenceHigh},
+		{name: "WAVE", data: "RIFF\x24\x00\x00\x00WAVEfmt ", mime: "audio/wav", confidence: fsutil.ConfidenceHigh},
+		{name: "ZIP", data: "PK\x03\x04\x14\x00\x00\x00", mime: "application/zip", confidence: fsutil.ConfidenceMedium},
+		{
+			name:       "EPUB",
+			data:       "PK\x03\x04" + strings.Repeat("\x00", 26) + "mimetypeapplication/epub+zip",
+			mime:       "application/epub+zip",
+			confidence: fsutil.ConfidenceHigh,
+		},
+		{name: "TAR", data: tarHeader(), mime: "application/x-tar", confidence: fsutil.ConfidenceHigh},
+		{name: "XML", data: "<?xml version=\"1.0\"?><mets/>", mime: "application/xml", confidence: fsutil.ConfidenceMedium},
+		{name: "XML with BOM", data: "\xef\xbb\xbf<?xml version=\"1.0\"?>", mime: "application/xml", confidence: fsutil.ConfidenceMedium},
+		{name: "Text", data: "Hello, wörld!\n", mime: "text/plain", confidence: fsutil.ConfidenceLow},
+		{name: "Binary", data: "\x00\x01\x02\x03", mime: "application/octet-stream", confidence: fsutil.ConfidenceNone},
+		{name: "Empty", data: "", mime: "application/octet-stream", confidence: fsutil.ConfidenceNone},
+	} {
+		t.Run("Identifies "+tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			id, err := fsutil.Identify(strings.NewReader(tc.data))
+			assert.NilError(t, err)
+			assert.Equal(t, id.MIME, tc.mime)
+			assert.Equal(t, id.Confidence, tc.confidence)
+		})
+	}
+
+	t.Run("Identifies long text truncated mid-character", func(t *testing.T) {
+		t.Parallel()
+
+		data := strings.Repeat("a", 8191) + "é"
+		id, err := fsutil.Identify(strings.NewReader(data))
+		assert.NilError(t, err)
+		assert.Equal(t, id.MIME, "text/plain")
+	})
+
+	t.Run("Matches extensions", func(t *testing.T) {
+		t.Parallel()
+
+		id, err := fsutil.Identify(bytes.NewReader([]byte("%PDF-1.4")))
+		assert.NilError(t, err)
+		assert.Equal(t, id.MatchesExt("report.PDF"), true)
+		assert.Equal(t, id.MatchesExt("report.doc"), false)
+		assert.Equal(t, id.Confidence.String(), "high")
+	})
+}
+
+func TestIdentifyFile(t *testing.T) {
+	t.Parallel()
+
+	td := tfs.NewDir(t, "enduro-test-fsutil", tfs.WithFile("a.pdf", "%PDF-1.4"))
+
+	id, err := fsutil.IdentifyFile(td.Join("a.pdf"))
+	assert.NilError(t, err)
+	assert.Equal(t, id.Name, "PDF")
+
+	_, err = fsutil.IdentifyFile(td.Join("missing"))
+	assert.ErrorContains(t, err, "identify: open ")
+}
+
+func TestIdentifyTree(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"objects/report.pdf":   {Data: []byte("%PDF-1.4")},
+		"objects/image.jpg":    {Data: []byte("\x89PNG\r\n\x1a\n")},
+		"objects/notes.md":     {Data: []byte("# Notes")},
+		"metadata/mets.xml":    {Data: []byte("<?xml version=\"1.0\"?>")},
+		"metadata/data.bin":    {Data: []byte{0, 1, 2}},
+		"metadata/checksum.sh": {Data: []byte("#!/bin/sh")},
+	}
+
+	ids, err := fsutil.IdentifyTree(fsys)
+	assert.NilError(t, err)
+
+	var got []string
+	for _, id := range ids {
+		s := id.Path + " " + id.MIME
+		if id.ExtMismatch {
+			s += " (mismatch)"
+		}
+		got = append(got, s)
+	}
+	assert.DeepEqual(t, got, []string{
+		"metadata/checksum.sh text/plain",
+		"metadata/data.bin application/octet-stream",
+		"metadata/mets.xml application/xml",
+		"objects/image.jpg image/png (mismatch)",
+		"objects/notes.md text/plain",
+		"objects/report.pdf application/pdf",
+	})
+}
@@ -0,0 +1,322 @@
+package fsutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lockRetryInterval is the time between attempts to acquire a lock while
+// waiting for it.
+const lockRetryInterval = 50 * time.Millisecond
+
+// ErrLocked is returned when a lock is held by another owner.
+var ErrLocked = errors.New("locked")
+
+// FileLock is an advisory lock on a file, based on flock(2). Locks are held by
+// the FileLock value, so two FileLocks for the same path exclude each other
+// even in the same process. Advisory locks only exclude processes that use
+// them and, depending on the file system, may not work on network shares.
+//
+// The lock file is created if it doesn't exist and isn't removed on Unlock, as
+// doing so would race with other processes opening it.
+type FileLock struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewFileLock returns a FileLock for the file at path.
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// Path returns the path of the lock file.
+func (l *FileLock) Path() string {
+	return l.path
+}
+
+// Lock acquires an exclusive lock, waiting until it's available.
+func (l *FileLock) Lock() error {
+	_, err := l.lock(true, true)
+	return err
+}
+
+// RLock acquires a shared lock, waiting until no exclusive lock is held.
+func (l *FileLock) RLock() error {
+	_, err := l.lock(false, true)
+	return err
+}
+
+// TryLock tries to acquire an exclusive lock without waiting, reporting
+// whether it succeeded.
+func (l *FileLock) TryLock() (bool, error) {
+	return l.lock(true, false)
+}
+
+// TryRLock tries to acquire a shared lock without waiting, reporting whether
+// it succeeded.
+func (l *FileLock) TryRLock() (bool, error) {
+	return l.lock(false, false)
+}
+
+// LockContext acquires an exclusive lock, waiting until it's available or
+// until ctx is done.
+func (l *FileLock) LockContext(ctx context.Context) error {
+	return retryLock(ctx, l.TryLock)
+}
+
+// RLockContext acquires a shared lock, waiting until no exclusive lock is held
+// or until ctx is done.
+func (l *FileLock) RLockContext(ctx context.Context) error {
+	return retryLock(ctx, l.TryRLock)
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return fmt.Errorf("unlock %s: not locked", l.path)
+	}
+
+	// Closing the file releases the lock.
+	err := l.f.Close()
+	l.f = nil
+	if err != nil {
+		return fmt.Errorf("unlock %s: %v", l.path, err)
+	}
+
+	return nil
+}
+
+func (l *FileLock) lock(exclusive, wait bool) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f != nil {
+		return false, fmt.Errorf("lock %s: already locked", l.path)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_RDONLY|os.O_CREATE, 0o666)
+	if err != nil {
+		return false, fmt.Errorf("lock %s: %v", l.path, err)
+	}
+
+	if err := flock(f, exclusive, wait); err != nil {
+		f.Close()
+		if errors.Is(err, ErrLocked) {
+			return false, nil
+		}
+		return false, fmt.Errorf("lock %s: %w", l.path, err)
+	}
+	l.f = f
+
+	return true, nil
+}
+
+// retryLock calls try until it succeeds or fails, or until ctx is done.
+func retryLock(ctx context.Context, try func() (bool, error)) error {
+	ticker := time.NewTicker(lockRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		if ok, err := try(); err != nil || ok {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// DirLockOptions configures [LockDir] and [TryLockDir].
+type DirLockOptions struct {
+	// StaleAfter makes locks older than this duration stale when their owner
+	// can't be checked, i.e. when they were created on another host or on a
+	// platform where processes can't be checked. Holders of such locks must
+	// call [DirLock.Refresh] more often than this duration. Zero disables
+	// the age check.
+	StaleAfter time.Duration
+}
+
+// DirLock is a lock represented by a directory, created atomically with
+// mkdir(2), which unlike flock(2) works on most network file systems. The lock
+// directory holds an "owner" file recording the PID and hostname of the
+// process holding the lock, so locks left behind by dead processes can be
+// detected as stale and broken.
+//
+// Lock directories are usually siblings of the directory they protect, so
+// they aren't affected by operations on it:
+//
+//	lock, err := fsutil.LockDir(ctx, transfer+".lock", fsutil.DirLockOptions{})
+//	if err != nil {
+//		return err
+//	}
+//	defer lock.Unlock()
+//
+//	return fsutil.Move(transfer, dst)
+type DirLock struct {
+	path string
+}
+
+// lockOwner identifies the process holding a DirLock.
+type lockOwner struct {
+	pid      int
+	hostname string
+}
+
+// LockDir creates the lock directory at path, waiting until it's available or
+// until ctx is done. Stale locks are broken.
+func LockDir(ctx context.Context, path string, opts DirLockOptions) (*DirLock, error) {
+	var lock *DirLock
+	err := retryLock(ctx, func() (bool, error) {
+		var err error
+		lock, err = TryLockDir(path, opts)
+		if errors.Is(err, ErrLocked) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// TryLockDir creates the lock directory at path without waiting, breaking the
+// lock if it's stale. It returns an error wrapping ErrLocked if the lock is
+// held.
+func TryLockDir(path string, opts DirLockOptions) (*DirLock, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("lock dir %s: %v", path, err)
+	}
+	owner := lockOwner{pid: os.Getpid(), hostname: hostname}
+
+	for range 2 {
+		err := os.Mkdir(path, 0o755)
+		if err == nil {
+			if err := writeLockOwner(path, owner); err != nil {
+				os.RemoveAll(path)
+				return nil, fmt.Errorf("lock dir %s: %v", path, err)
+			}
+			return &DirLock{path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("lock dir %s: %v", path, err)
+		}
+
+		state, err := readDirLock(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Released in the meantime.
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("lock dir %s: %v", path, err)
+		}
+		if !state.stale(owner, opts) {
+			break
+		}
+		// Another process may have broken the lock and acquired it since it
+		// was checked. Rename the lock aside and check that it's the one found
+		// stale before removing it, restoring it otherwise.
+		tmp := fmt.Sprintf("%s.stale-%d", path, owner.pid)
+		os.RemoveAll(tmp)
+		if err := os.Rename(path, tmp); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			break
+		}
+		if moved, err := readDirLock(tmp); err != nil || !moved.same(state) {
+			if _, err := os.Lstat(path); !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("lock dir %s: can't restore lock moved to %s", path, tmp)
+			}
+			if err := os.Rename(tmp, path); err != nil {
+				return nil, fmt.Errorf("lock dir %s: restore lock: %v", path, err)
+			}
+			break
+		}
+		os.RemoveAll(tmp)
+	}
+
+	return nil, fmt.Errorf("lock dir %s: %w", path, ErrLocked)
+}
+
+// Path returns the path of the lock directory.
+func (l *DirLock) Path() string {
+	return l.path
+}
+
+// Refresh updates the modification time of the lock directory, so it isn't
+// considered stale by processes that can't check its owner, see
+// DirLockOptions.StaleAfter.
+func (l *DirLock) Refresh() error {
+	now := time.Now()
+	if err := os.Chtimes(l.path, now, now); err != nil {
+		return fmt.Errorf("refresh dir lock %s: %v", l.path, err)
+	}
+	return nil
+}
+
+// Unlock removes the lock directory.
+func (l *DirLock) Unlock() error {
+	if err := os.RemoveAll(l.path); err != nil {
+		return fmt.Errorf("unlock dir %s: %v", l.path, err)
+	}
+	return nil
+}
+
+func writeLockOwner(path string, owner lockOwner) error {
+	data := fmt.Sprintf("%d\n%s\n", owner.pid, owner.hostname)
+	return os.WriteFile(filepath.Join(path, "owner"), []byte(data), 0o644)
+}
+
+// dirLockState is the state of a lock directory at some point.
+type dirLockState struct {
+	fi    os.FileInfo
+	owner []byte
+}
+
+// readDirLock returns the state of the lock directory at path. The owner is
+// nil if the owner file can't be read, e.g. because it isn't written yet.
+func readDirLock(path string) (*dirLockState, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	owner, _ := os.ReadFile(filepath.Join(path, "owner"))
+
+	return &dirLockState{fi: fi, owner: owner}, nil
+}
+
+// same reports whether s and o are the states of the same lock.
+func (s *dirLockState) same(o *dirLockState) bool {
+	return os.SameFile(s.fi, o.fi) && bytes.Equal(s.owner, o.owner)
+}
+
+// stale reports whether the lock is stale: its owner process is known to be
+// dead or, when the owner can't be checked, it's older than opts.StaleAfter.
+func (s *dirLockState) stale(self lockOwner, opts DirLockOptions) bool {
+	pid, hostname, _ := strings.Cut(strings.TrimSpace(string(s.owner)), "\n")
+	n, err := strconv.Atoi(pid)
+	owner := lockOwner{pid: n, hostname: hostname}
+	if err == nil && owner.hostname == self.hostname && canCheckProcesses {
+		return owner.pid != self.pid && !processExists(owner.pid)
+	}
+
+	// The owner file may also not be written yet, or is left incomplete.
+	return opts.StaleAfter > 0 && time.Since(s.fi.ModTime()) > opts.StaleAfter
+}
@@ -0,0 +1,44 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// flock applies an advisory lock to f, returning ErrLocked if wait is false
+// and the lock is held.
+func flock(f *os.File, exclusive, wait bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.EWOULDBLOCK):
+			return ErrLocked
+		default:
+			return os.NewSyscallError("flock", err)
+		}
+	}
+}
+
+// canCheckProcesses reports whether processExists can check processes.
+const canCheckProcesses = true
+
+// processExists reports whether a process with the given PID exists.
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,23 @@
+//go:build !(linux || darwin || freebsd || openbsd || netbsd || dragonfly)
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+)
+
+// flock is not supported on this platform.
+func flock(f *os.File, exclusive, wait bool) error {
+	return errors.ErrUnsupported
+}
+
+// canCheckProcesses is false as processes can't be checked on this platform,
+// locks are only considered stale based on their age.
+const canCheckProcesses = false
+
+// processExists can't check processes on this platform, so it assumes they
+// exist.
+func processExists(pid int) bool {
+	return true
+}
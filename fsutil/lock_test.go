@@ -0,0 +1,208 @@
+package fsutil_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+func TestFileLock(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("file locks aren't supported on Windows")
+	}
+
+	t.Run("Excludes other exclusive and shared locks", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "lock")
+		l1, l2 := fsutil.NewFileLock(path), fsutil.NewFileLock(path)
+
+		assert.NilError(t, l1.Lock())
+
+		ok, err := l2.TryLock()
+		assert.NilError(t, err)
+		assert.Equal(t, ok, false)
+
+		ok, err = l2.TryRLock()
+		assert.NilError(t, err)
+		assert.Equal(t, ok, false)
+
+		assert.NilError(t, l1.Unlock())
+
+		ok, err = l2.TryLock()
+		assert.NilError(t, err)
+		assert.Equal(t, ok, true)
+		assert.NilError(t, l2.Unlock())
+	})
+
+	t.Run("Shares shared locks", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "lock")
+		l1, l2, l3 := fsutil.NewFileLock(path), fsutil.NewFileLock(path), fsutil.NewFileLock(path)
+
+		assert.NilError(t, l1.RLock())
+		assert.NilError(t, l2.RLock())
+
+		ok, err := l3.TryLock()
+		assert.NilError(t, err)
+		assert.Equal(t, ok, false)
+
+		assert.NilError(t, l1.Unlock())
+		assert.NilError(t, l2.Unlock())
+	})
+
+	t.Run("Waits for the lock until the context is done", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "lock")
+		l1, l2 := fsutil.NewFileLock(path), fsutil.NewFileLock(path)
+		assert.NilError(t, l1.Lock())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, l2.LockContext(ctx), context.DeadlineExceeded)
+
+		time.AfterFunc(100*time.Millisecond, func() { l1.Unlock() })
+		assert.NilError(t, l2.LockContext(context.Background()))
+		assert.NilError(t, l2.Unlock())
+	})
+
+	t.Run("Fails to lock twice or unlock when not locked", func(t *testing.T) {
+		t.Parallel()
+
+		l := fsutil.NewFileLock(filepath.Join(t.TempDir(), "lock"))
+		assert.ErrorContains(t, l.Unlock(), "not locked")
+
+		assert.NilError(t, l.Lock())
+		assert.ErrorContains(t, l.RLock(), "already locked")
+		assert.NilError(t, l.Unlock())
+	})
+}
+
+func TestDirLock(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Excludes other owners until unlocked", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "transfer.lock")
+
+		lock, err := fsutil.TryLockDir(path, fsutil.DirLockOptions{})
+		assert.NilError(t, err)
+		assert.Equal(t, lock.Path(), path)
+
+		_, err = fsutil.TryLockDir(path, fsutil.DirLockOptions{})
+		assert.ErrorIs(t, err, fsutil.ErrLocked)
+
+		assert.NilError(t, lock.Unlock())
+		lock, err = fsutil.TryLockDir(path, fsutil.DirLockOptions{})
+		assert.NilError(t, err)
+		assert.NilError(t, lock.Unlock())
+	})
+
+	t.Run("Waits for the lock until the context is done", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "transfer.lock")
+		first, err := fsutil.TryLockDir(path, fsutil.DirLockOptions{})
+		assert.NilError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = fsutil.LockDir(ctx, path, fsutil.DirLockOptions{})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		time.AfterFunc(100*time.Millisecond, func() { first.Unlock() })
+		lock, err := fsutil.LockDir(context.Background(), path, fsutil.DirLockOptions{})
+		assert.NilError(t, err)
+		assert.NilError(t, lock.Unlock())
+	})
+
+	t.Run("Breaks locks of dead processes", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS == "windows" {
+			t.Skip("processes can't be checked on Windows")
+		}
+
+		hostname, err := os.Hostname()
+		assert.NilError(t, err)
+
+		// PIDs are lower than 2^22 on Linux, and usually much lower elsewhere.
+		path := filepath.Join(t.TempDir(), "transfer.lock")
+		assert.NilError(t, os.Mkdir(path, 0o755))
+		assert.NilError(t, os.WriteFile(filepath.Join(path, "owner"), []byte("99999999\n"+hostname+"\n"), 0o644))
+
+		lock, err := fsutil.TryLockDir(path, fsutil.DirLockOptions{})
+		assert.NilError(t, err)
+		assert.NilError(t, lock.Unlock())
+	})
+
+	t.Run("Keeps old locks of live processes", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS == "windows" {
+			t.Skip("processes can't be checked on Windows")
+		}
+
+		hostname, err := os.Hostname()
+		assert.NilError(t, err)
+
+		// The parent process outlives the test.
+		path := filepath.Join(t.TempDir(), "transfer.lock")
+		assert.NilError(t, os.Mkdir(path, 0o755))
+		owner := fmt.Sprintf("%d\n%s\n", os.Getppid(), hostname)
+		assert.NilError(t, os.WriteFile(filepath.Join(path, "owner"), []byte(owner), 0o644))
+		old := time.Now().Add(-time.Hour)
+		assert.NilError(t, os.Chtimes(path, old, old))
+
+		_, err = fsutil.TryLockDir(path, fsutil.DirLockOptions{StaleAfter: time.Minute})
+		assert.ErrorIs(t, err, fsutil.ErrLocked)
+	})
+
+	t.Run("Refreshes the lock", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "transfer.lock")
+		lock, err := fsutil.TryLockDir(path, fsutil.DirLockOptions{})
+		assert.NilError(t, err)
+		defer lock.Unlock()
+
+		old := time.Now().Add(-time.Hour)
+		assert.NilError(t, os.Chtimes(path, old, old))
+		assert.NilError(t, lock.Refresh())
+
+		fi, err := os.Stat(path)
+		assert.NilError(t, err)
+		assert.Assert(t, time.Since(fi.ModTime()) < time.Minute)
+	})
+
+	t.Run("Keeps locks of other hosts until they're too old", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "transfer.lock")
+		assert.NilError(t, os.Mkdir(path, 0o755))
+		assert.NilError(t, os.WriteFile(filepath.Join(path, "owner"), []byte("1\nother-host\n"), 0o644))
+
+		_, err := fsutil.TryLockDir(path, fsutil.DirLockOptions{StaleAfter: time.Hour})
+		assert.ErrorIs(t, err, fsutil.ErrLocked)
+
+		old := time.Now().Add(-2 * time.Hour)
+		assert.NilError(t, os.Chtimes(path, old, old))
+
+		lock, err := fsutil.TryLockDir(path, fsutil.DirLockOptions{StaleAfter: time.Hour})
+		assert.NilError(t, err)
+		assert.NilError(t, lock.Unlock())
+	})
+}
@@ -0,0 +1,359 @@
+package fsutil
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// MemFS is an in-memory [ChtimesFS], e.g. to test code using file system
+// trees without touching the disk. The zero value is an empty file system
+// ready to use. A MemFS is safe for concurrent use.
+type MemFS struct {
+	mu    sync.RWMutex
+	nodes map[string]*memNode
+}
+
+var _ ChtimesFS = (*MemFS)(nil)
+
+// memNode is a file or directory of a MemFS.
+type memNode struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMemFS returns an empty MemFS.
+func NewMemFS() *MemFS {
+	return &MemFS{}
+}
+
+// init adds the root directory, it must be called with the lock held.
+func (m *MemFS) init() {
+	if m.nodes == nil {
+		m.nodes = map[string]*memNode{
+			".": {mode: fs.ModeDir | 0o755, modTime: time.Now()},
+		}
+	}
+}
+
+// node returns the named node, or an error if name is invalid or doesn't
+// exist. It must be called with the lock held.
+func (m *MemFS) node(op, name string) (*memNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	m.init()
+	n, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return n, nil
+}
+
+// children returns the names of the entries of the directory dir, sorted. It
+// must be called with the lock held.
+func (m *MemFS) children(dir string) []string {
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+
+	var names []string
+	for name := range m.nodes {
+		if name == "." || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if rest := name[len(prefix):]; !strings.Contains(rest, "/") {
+			names = append(names, rest)
+		}
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// checkParent returns an error if the parent directory of name doesn't exist.
+// It must be called with the lock held.
+func (m *MemFS) checkParent(op, name string) error {
+	if name == "." {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	parent, err := m.node(op, path.Dir(name))
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.mode.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n, err := m.node("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info := n.info(name)
+
+	if !n.mode.IsDir() {
+		return &memFile{info: info, Reader: bytes.NewReader(slices.Clone(n.data))}, nil
+	}
+
+	children := m.children(name)
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, child := range children {
+		entries = append(entries, fs.FileInfoToDirEntry(m.nodes[path.Join(name, child)].info(child)))
+	}
+
+	return &memDir{info: info, entries: entries}, nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n, err := m.node("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(name), nil
+}
+
+func (m *MemFS) Create(name string) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkParent("create", name); err != nil {
+		return nil, err
+	}
+	n, err := m.node("create", name)
+	switch {
+	case err == nil && n.mode.IsDir():
+		return nil, &fs.PathError{Op: "create", Path: name, Err: syscall.EISDIR}
+	case err == nil:
+		n.data, n.modTime = nil, time.Now()
+	default:
+		n = &memNode{mode: 0o644, modTime: time.Now()}
+		m.nodes[name] = n
+	}
+
+	return &memWriter{fs: m, node: n}, nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	m.init()
+
+	dir := ""
+	for elem := range strings.SplitSeq(name, "/") {
+		dir = path.Join(dir, elem)
+		n, ok := m.nodes[dir]
+		if !ok {
+			m.nodes[dir] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+		} else if !n.mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+		}
+	}
+
+	return nil
+}
+
+func (m *MemFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.node("rename", oldname)
+	if err != nil {
+		return err
+	}
+	if oldname == "." {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrInvalid}
+	}
+	if err := m.checkParent("rename", newname); err != nil {
+		return err
+	}
+	if oldname == newname {
+		return nil
+	}
+	if n.mode.IsDir() && strings.HasPrefix(newname, oldname+"/") {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrInvalid}
+	}
+	if target, ok := m.nodes[newname]; ok {
+		if target.mode.IsDir() || n.mode.IsDir() {
+			return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrExist}
+		}
+	}
+
+	for name, node := range m.nodes {
+		if name == oldname {
+			delete(m.nodes, name)
+			m.nodes[newname] = node
+		} else if rest, ok := strings.CutPrefix(name, oldname+"/"); ok {
+			delete(m.nodes, name)
+			m.nodes[newname+"/"+rest] = node
+		}
+	}
+
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.node("remove", name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	if n.mode.IsDir() && len(m.children(name)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	delete(m.nodes, name)
+
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+	m.init()
+
+	for n := range m.nodes {
+		if n == name || strings.HasPrefix(n, name+"/") {
+			delete(m.nodes, n)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.node("chmod", name)
+	if err != nil {
+		return err
+	}
+	n.mode = n.mode.Type() | mode.Perm()
+
+	return nil
+}
+
+// Chtimes changes the modification time of the named file, MemFS doesn't
+// record access times.
+func (m *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.node("chtimes", name)
+	if err != nil {
+		return err
+	}
+	n.modTime = mtime
+
+	return nil
+}
+
+func (n *memNode) info(name string) *memInfo {
+	return &memInfo{
+		name:    path.Base(name),
+		size:    int64(len(n.data)),
+		mode:    n.mode,
+		modTime: n.modTime,
+	}
+}
+
+// memInfo is the fs.FileInfo of a MemFS node.
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *memInfo) Name() string       { return i.name }
+func (i *memInfo) Size() int64        { return i.size }
+func (i *memInfo) Mode() fs.FileMode  { return i.mode }
+func (i *memInfo) ModTime() time.Time { return i.modTime }
+func (i *memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memInfo) Sys() any           { return nil }
+
+// memFile is an open MemFS file. It reads a copy of the data the file had when
+// it was opened.
+type memFile struct {
+	*bytes.Reader
+	info *memInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+// memDir is an open MemFS directory.
+type memDir struct {
+	info    *memInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: syscall.EISDIR}
+}
+
+func (d *memDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	rest = rest[:min(count, len(rest))]
+	d.offset += len(rest)
+
+	return rest, nil
+}
+
+// memWriter writes to a MemFS file.
+type memWriter struct {
+	fs   *MemFS
+	node *memNode
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+
+	w.node.data = append(w.node.data, p...)
+	w.node.modTime = time.Now()
+
+	return len(p), nil
+}
+
+func (w *memWriter) Close() error { return nil }
@@ -0,0 +1,210 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// SymlinkPolicy determines how [SetFileModesWithOptions] handles symbolic
+// links.
+type SymlinkPolicy int
+
+const (
+	// SymlinksSkip leaves symbolic links and their targets untouched.
+	SymlinksSkip SymlinkPolicy = iota
+	// SymlinksNoFollow changes the ownership of symbolic links themselves.
+	// Their modes are left untouched as most platforms don't support them.
+	SymlinksNoFollow
+	// SymlinksFollow applies modes and ownership to the targets of symbolic
+	// links, which may be outside root.
+	SymlinksFollow
+)
+
+// Owner identifies a file owner by numeric user and group IDs. Use -1 to leave
+// either the user or the group unchanged.
+type Owner struct {
+	UID int
+	GID int
+}
+
+// FileModeOptions configures [SetFileModesWithOptions].
+type FileModeOptions struct {
+	// DirMode and FileMode are the permissions applied to directories and
+	// to all other entries.
+	DirMode  fs.FileMode
+	FileMode fs.FileMode
+	// Umask bits are cleared from DirMode and FileMode before they're
+	// applied, e.g. 0o022.
+	Umask fs.FileMode
+	// Owner, when set, is applied to every entry.
+	Owner *Owner
+	// Symlinks determines how symbolic links are handled. Defaults to
+	// SymlinksSkip.
+	Symlinks SymlinkPolicy
+	// ContinueOnError processes every entry, returning all errors joined,
+	// instead of stopping at the first error.
+	ContinueOnError bool
+	// DryRun reports the changes without applying them.
+	DryRun bool
+}
+
+// FileModeChange describes a change made, or that would be made in a dry run,
+// by [SetFileModesWithOptions]. Fields for attributes that aren't changed hold
+// equal old and new values.
+type FileModeChange struct {
+	Path     string
+	OldMode  fs.FileMode
+	NewMode  fs.FileMode
+	OldOwner Owner
+	NewOwner Owner
+}
+
+// ModeChanged reports whether the change modifies the file mode.
+func (c FileModeChange) ModeChanged() bool {
+	return c.OldMode != c.NewMode
+}
+
+// OwnerChanged reports whether the change modifies the file ownership.
+func (c FileModeChange) OwnerChanged() bool {
+	return c.OldOwner != c.NewOwner
+}
+
+// SetFileModesWithOptions recursively sets the file mode, and optionally the
+// ownership, of directory root and its contents. Entries are only changed
+// when their current mode or ownership differ from the requested ones. It
+// returns the list of changes made, or that would be made when opts.DryRun is
+// set.
+func SetFileModesWithOptions(root string, opts FileModeOptions) ([]FileModeChange, error) {
+	dirMode := opts.DirMode.Perm() &^ opts.Umask
+	fileMode := opts.FileMode.Perm() &^ opts.Umask
+
+	var (
+		changes []FileModeChange
+		errs    []error
+	)
+	fail := func(err error) error {
+		if opts.ContinueOnError {
+			errs = append(errs, err)
+			return nil
+		}
+		return err
+	}
+
+	err := filepath.WalkDir(root,
+		func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				if err := fail(err); err != nil {
+					return err
+				}
+				if d != nil && d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			change, err := fileModeChange(path, d, dirMode, fileMode, opts)
+			if err != nil {
+				return fail(fmt.Errorf("set file mode: %v", err))
+			}
+			if change == nil {
+				return nil
+			}
+			changes = append(changes, *change)
+
+			if !opts.DryRun {
+				if err := applyFileModeChange(*change, d, opts.Symlinks); err != nil {
+					return fail(fmt.Errorf("set file mode: %v", err))
+				}
+			}
+
+			return nil
+		},
+	)
+	if err != nil {
+		return changes, err
+	}
+
+	return changes, errors.Join(errs...)
+}
+
+// fileModeChange returns the change needed for the entry at path, or nil if
+// the entry doesn't need to be changed.
+func fileModeChange(
+	path string,
+	d os.DirEntry,
+	dirMode, fileMode fs.FileMode,
+	opts FileModeOptions,
+) (*FileModeChange, error) {
+	isLink := d.Type()&fs.ModeSymlink != 0
+	if isLink && opts.Symlinks == SymlinksSkip {
+		return nil, nil
+	}
+
+	var (
+		fi  fs.FileInfo
+		err error
+	)
+	if isLink && opts.Symlinks == SymlinksFollow {
+		fi, err = os.Stat(path)
+	} else {
+		fi, err = d.Info()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mode := fileMode
+	if fi.IsDir() {
+		mode = dirMode
+	}
+
+	c := FileModeChange{Path: path, OldMode: fi.Mode().Perm(), NewMode: mode}
+	if isLink && opts.Symlinks == SymlinksNoFollow {
+		c.NewMode = c.OldMode
+	}
+	if opts.Owner != nil {
+		uid, gid, ok := fileOwner(fi)
+		if !ok {
+			return nil, fmt.Errorf("%s: file ownership is not supported", path)
+		}
+		c.OldOwner = Owner{UID: uid, GID: gid}
+		c.NewOwner = c.OldOwner
+		if opts.Owner.UID >= 0 {
+			c.NewOwner.UID = opts.Owner.UID
+		}
+		if opts.Owner.GID >= 0 {
+			c.NewOwner.GID = opts.Owner.GID
+		}
+	}
+
+	if !c.ModeChanged() && !c.OwnerChanged() {
+		return nil, nil
+	}
+
+	return &c, nil
+}
+
+// applyFileModeChange applies c to the file system.
+func applyFileModeChange(c FileModeChange, d os.DirEntry, symlinks SymlinkPolicy) error {
+	noFollow := d.Type()&fs.ModeSymlink != 0 && symlinks == SymlinksNoFollow
+
+	if c.OwnerChanged() {
+		chown := os.Chown
+		if noFollow {
+			chown = os.Lchown
+		}
+		if err := chown(c.Path, c.NewOwner.UID, c.NewOwner.GID); err != nil {
+			return err
+		}
+	}
+	if c.ModeChanged() {
+		if err := os.Chmod(c.Path, c.NewMode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
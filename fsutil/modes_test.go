@@ -0,0 +1,121 @@
+package fsutil_test
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	tfs "gotest.tools/v3/fs"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+func TestSetFileModesWithOptions(t *testing.T) {
+	t.Parallel()
+
+	newTransfer := func(t *testing.T) *tfs.Dir {
+		return tfs.NewDir(t, "enduro-test-fsutil",
+			tfs.WithDir("transfer", tfs.WithMode(0o755),
+				tfs.WithFile("test1", "I'm a test file.", tfs.WithMode(0o600)),
+				tfs.WithFile("test2", "Another test file.", tfs.WithMode(0o644)),
+				tfs.WithSymlink("link", "test1"),
+			),
+		)
+	}
+
+	t.Run("Changes only entries with different modes", func(t *testing.T) {
+		t.Parallel()
+
+		td := newTransfer(t)
+
+		changes, err := fsutil.SetFileModesWithOptions(td.Join("transfer"), fsutil.FileModeOptions{
+			DirMode:  0o777,
+			FileMode: 0o666,
+			Umask:    0o022,
+		})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, changes, []fsutil.FileModeChange{
+			{Path: td.Join("transfer", "test1"), OldMode: 0o600, NewMode: 0o644},
+		})
+		assert.Assert(t, tfs.Equal(td.Join("transfer"), tfs.Expected(t, tfs.WithMode(0o755),
+			tfs.WithFile("test1", "I'm a test file.", tfs.WithMode(0o644)),
+			tfs.WithFile("test2", "Another test file.", tfs.WithMode(0o644)),
+			tfs.WithSymlink("link", td.Join("transfer", "test1")),
+		)))
+	})
+
+	t.Run("Reports changes without applying them in a dry run", func(t *testing.T) {
+		t.Parallel()
+
+		td := newTransfer(t)
+		manifest := tfs.ManifestFromDir(t, td.Path())
+
+		changes, err := fsutil.SetFileModesWithOptions(td.Join("transfer"), fsutil.FileModeOptions{
+			DirMode:  0o700,
+			FileMode: 0o600,
+			Owner:    &fsutil.Owner{UID: os.Getuid() + 1, GID: -1},
+			DryRun:   true,
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, len(changes), 3)
+		assert.Equal(t, changes[0].Path, td.Join("transfer"))
+		assert.Equal(t, changes[0].ModeChanged(), true)
+		assert.Equal(t, changes[0].OwnerChanged(), true)
+		assert.Equal(t, changes[0].NewOwner.UID, os.Getuid()+1)
+		assert.Equal(t, changes[0].NewOwner.GID, os.Getgid())
+		assert.Equal(t, changes[1].Path, td.Join("transfer", "test1"))
+		assert.Equal(t, changes[1].ModeChanged(), false)
+		assert.Assert(t, tfs.Equal(td.Path(), manifest))
+	})
+
+	t.Run("Follows symlinks", func(t *testing.T) {
+		t.Parallel()
+
+		td := newTransfer(t)
+
+		changes, err := fsutil.SetFileModesWithOptions(td.Join("transfer"), fsutil.FileModeOptions{
+			DirMode:  0o755,
+			FileMode: 0o640,
+			Symlinks: fsutil.SymlinksFollow,
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, len(changes), 2)
+		assert.Equal(t, changes[0].Path, td.Join("transfer", "link"))
+
+		fi, err := os.Stat(td.Join("transfer", "test1"))
+		assert.NilError(t, err)
+		assert.Equal(t, fi.Mode().Perm(), fs.FileMode(0o640))
+	})
+
+	t.Run("Collects all errors", func(t *testing.T) {
+		t.Parallel()
+
+		td := newTransfer(t)
+		assert.NilError(t, os.Symlink("missing", td.Join("transfer", "broken")))
+
+		changes, err := fsutil.SetFileModesWithOptions(td.Join("transfer"), fsutil.FileModeOptions{
+			DirMode:         0o755,
+			FileMode:        0o640,
+			Symlinks:        fsutil.SymlinksFollow,
+			ContinueOnError: true,
+		})
+		assert.ErrorContains(t, err, "set file mode: stat "+td.Join("transfer", "broken"))
+		assert.Equal(t, len(changes), 2)
+	})
+
+	t.Run("Stops at the first error", func(t *testing.T) {
+		t.Parallel()
+
+		td := newTransfer(t)
+		assert.NilError(t, os.Symlink("missing", td.Join("transfer", "broken")))
+
+		changes, err := fsutil.SetFileModesWithOptions(td.Join("transfer"), fsutil.FileModeOptions{
+			DirMode:  0o755,
+			FileMode: 0o640,
+			Symlinks: fsutil.SymlinksFollow,
+		})
+		assert.ErrorContains(t, err, "set file mode: stat "+td.Join("transfer", "broken"))
+		assert.Equal(t, len(changes), 0)
+	})
+}
@@ -0,0 +1,126 @@
+package fsutil
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RootFS is a [ChtimesFS] whose operations can't access files outside its
+// root directory, even through symbolic links or ".." elements, and even if
+// the tree is modified concurrently. It's based on [os.Root], see its
+// documentation for platform specific limitations.
+//
+// Every fsutil function taking a [WritableFS] or an [fs.FS], e.g. [MoveFS] or
+// [Sync], can run inside a RootFS.
+type RootFS struct {
+	root *os.Root
+}
+
+var _ ChtimesFS = (*RootFS)(nil)
+
+// OpenRootFS opens the directory dir as a RootFS. It must be closed when no
+// longer needed.
+func OpenRootFS(dir string) (*RootFS, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &RootFS{root: root}, nil
+}
+
+// Name returns the name of the root directory, as passed to OpenRootFS.
+func (r *RootFS) Name() string {
+	return r.root.Name()
+}
+
+// Close closes the root directory.
+func (r *RootFS) Close() error {
+	return r.root.Close()
+}
+
+// name validates name and returns it in the OS format.
+func (r *RootFS) name(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.FromSlash(name), nil
+}
+
+func (r *RootFS) Open(name string) (fs.File, error) {
+	n, err := r.name("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return r.root.Open(n)
+}
+
+func (r *RootFS) Stat(name string) (fs.FileInfo, error) {
+	n, err := r.name("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return r.root.Stat(n)
+}
+
+func (r *RootFS) Create(name string) (io.WriteCloser, error) {
+	n, err := r.name("create", name)
+	if err != nil {
+		return nil, err
+	}
+	return r.root.Create(n)
+}
+
+func (r *RootFS) MkdirAll(name string, perm fs.FileMode) error {
+	n, err := r.name("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return r.root.MkdirAll(n, perm)
+}
+
+func (r *RootFS) Rename(oldname, newname string) error {
+	o, err := r.name("rename", oldname)
+	if err != nil {
+		return err
+	}
+	n, err := r.name("rename", newname)
+	if err != nil {
+		return err
+	}
+	return r.root.Rename(o, n)
+}
+
+func (r *RootFS) Remove(name string) error {
+	n, err := r.name("remove", name)
+	if err != nil {
+		return err
+	}
+	return r.root.Remove(n)
+}
+
+func (r *RootFS) RemoveAll(name string) error {
+	n, err := r.name("removeall", name)
+	if err != nil {
+		return err
+	}
+	return r.root.RemoveAll(n)
+}
+
+func (r *RootFS) Chmod(name string, mode fs.FileMode) error {
+	n, err := r.name("chmod", name)
+	if err != nil {
+		return err
+	}
+	return r.root.Chmod(n, mode)
+}
+
+func (r *RootFS) Chtimes(name string, atime, mtime time.Time) error {
+	n, err := r.name("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return r.root.Chtimes(n, atime, mtime)
+}
@@ -0,0 +1,289 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultSanitizeMaxBytes is the default maximum length in bytes of sanitized
+// names, the limit of most file systems.
+const DefaultSanitizeMaxBytes = 255
+
+// SanitizeOptions configures [SanitizeName] and [SanitizeTree].
+type SanitizeOptions struct {
+	// Replacement replaces each disallowed character. Defaults to "_".
+	Replacement string
+	// ASCII transliterates non-ASCII characters, e.g. "é" becomes "e", and
+	// replaces those without an ASCII equivalent.
+	ASCII bool
+	// MaxBytes limits the length of names in bytes. Defaults to
+	// DefaultSanitizeMaxBytes.
+	MaxBytes int
+	// DryRun makes SanitizeTree report the renames without applying them.
+	DryRun bool
+}
+
+func (o *SanitizeOptions) setDefaults() {
+	if o.Replacement == "" {
+		o.Replacement = "_"
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = DefaultSanitizeMaxBytes
+	}
+}
+
+// windowsReserved lists the device names Windows doesn't allow as file names,
+// with or without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// transliterations maps letters that don't decompose into an ASCII letter and
+// combining marks to their usual ASCII spelling.
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE",
+	'ø': "o", 'Ø': "O", 'đ': "d", 'Đ': "D", 'ł': "l", 'Ł': "L",
+	'þ': "th", 'Þ': "TH", 'ð': "d", 'Ð': "D", 'ı': "i",
+}
+
+// SanitizeName returns a version of the file name that is safe to use on
+// Windows shares, as an S3 object key segment and in XML documents:
+//
+//   - the name is normalized to Unicode NFC;
+//   - control characters, characters not allowed in XML, invalid UTF-8 and
+//     the characters <>:"/\|?* are replaced;
+//   - trailing periods and spaces are removed;
+//   - reserved Windows device names, e.g. "CON", "aux.txt" or "nul.tar.gz",
+//     get the replacement appended to the part before their first period;
+//   - the name is truncated to MaxBytes, preserving its last extension.
+//
+// Empty names and the special names "." and ".." are replaced.
+func SanitizeName(name string, opts SanitizeOptions) string {
+	opts.setDefaults()
+
+	name = norm.NFC.String(strings.ToValidUTF8(name, opts.Replacement))
+	if opts.ASCII {
+		name = transliterate(name, opts.Replacement)
+	}
+
+	var b strings.Builder
+	for _, r := range name {
+		if disallowedRune(r) {
+			b.WriteString(opts.Replacement)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	name = strings.TrimRight(b.String(), ". ")
+	if name == "" {
+		return opts.Replacement
+	}
+
+	// Windows reserves device names followed by any extensions.
+	base := name
+	if i := extStart(name); i >= 0 {
+		base = name[:i]
+	}
+	if windowsReserved[strings.ToUpper(strings.TrimRight(base, " "))] {
+		name = base + opts.Replacement + name[len(base):]
+	}
+
+	stem, ext := splitLastExt(name)
+
+	return truncateName(stem, ext, opts.MaxBytes)
+}
+
+// transliterate replaces non-ASCII characters with their ASCII equivalents or
+// with repl.
+func transliterate(s, repl string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	if r, _, err := transform.String(t, s); err == nil {
+		s = r
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case transliterations[r] != "":
+			b.WriteString(transliterations[r])
+		default:
+			b.WriteString(repl)
+		}
+	}
+
+	return b.String()
+}
+
+// disallowedRune reports whether r can't be used in sanitized names.
+func disallowedRune(r rune) bool {
+	switch {
+	case r < 0x20, r == 0x7f:
+		return true
+	case strings.ContainsRune(`<>:"/\|?*`, r):
+		return true
+	case r >= 0x80 && r <= 0x9f: // C1 controls.
+		return true
+	case r == utf8.RuneError, r == 0xfffe, r == 0xffff:
+		return true
+	}
+	return false
+}
+
+// splitLastExt splits name before its last extension, treating dotfiles as
+// having no extension.
+func splitLastExt(name string) (string, string) {
+	if extStart(name) < 0 {
+		return name, ""
+	}
+	i := strings.LastIndexByte(name, '.')
+	return name[:i], name[i:]
+}
+
+// truncateName joins stem and ext, shortening stem, or ext when it's too long
+// itself, so the result fits in maxBytes without splitting characters.
+func truncateName(stem, ext string, maxBytes int) string {
+	if len(stem)+len(ext) <= maxBytes {
+		return stem + ext
+	}
+	if len(ext) >= maxBytes/2 {
+		stem, ext = stem+ext, ""
+	}
+
+	limit := max(maxBytes-len(ext), 0)
+	for limit > 0 && !utf8.RuneStart(stem[limit]) {
+		limit--
+	}
+
+	return strings.TrimRight(stem[:limit], ". ") + ext
+}
+
+// SanitizeTree sanitizes the names of every entry below the directory root,
+// which itself isn't renamed, using [SanitizeName]. Names that would collide
+// with an existing name in the same directory, ignoring case, get a numeric
+// suffix, e.g. "a_b_1.txt". Entries are renamed depth first unless
+// opts.DryRun is set.
+//
+// It returns a map from the original to the sanitized path, both relative to
+// root, of every renamed entry.
+func SanitizeTree(root string, opts SanitizeOptions) (map[string]string, error) {
+	opts.setDefaults()
+
+	renames := map[string]string{}
+	if err := sanitizeDir(root, ".", ".", opts, renames); err != nil {
+		return renames, fmt.Errorf("sanitize tree: %v", err)
+	}
+
+	return renames, nil
+}
+
+// sanitizeDir sanitizes the entries of the directory at root/rel, whose
+// sanitized relative path is newRel.
+func sanitizeDir(root, rel, newRel string, opts SanitizeOptions, renames map[string]string) error {
+	// Children are renamed before their parent, so rel is still valid.
+	dir := filepath.Join(root, rel)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// Reserve every current name so new names never clash with an entry
+	// that hasn't been renamed yet. Names that only differ in case or
+	// Unicode normalization share a key, hence the counts.
+	taken := make(map[string]int, len(entries))
+	for _, e := range entries {
+		taken[nameKey(e.Name())]++
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		newName := SanitizeName(name, opts)
+		if newName != name {
+			key, newKey := nameKey(name), nameKey(newName)
+			// The entry's own name only collides if another entry shares it.
+			if n := taken[newKey]; (newKey == key && n > 1) || (newKey != key && n > 0) {
+				newName = uniqueName(newName, taken, opts.MaxBytes)
+				newKey = nameKey(newName)
+			}
+			taken[key]--
+			taken[newKey]++
+		}
+
+		entryRel := filepath.Join(rel, name)
+		entryNewRel := filepath.Join(newRel, newName)
+		if e.IsDir() {
+			if err := sanitizeDir(root, entryRel, entryNewRel, opts, renames); err != nil {
+				return err
+			}
+		}
+		if newName == name {
+			continue
+		}
+
+		renames[entryRel] = entryNewRel
+		if !opts.DryRun {
+			if err := renameNoReplace(filepath.Join(dir, name), filepath.Join(dir, newName)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// nameKey returns the key identifying name among names that only differ in
+// case or Unicode normalization.
+func nameKey(name string) string {
+	return strings.ToLower(norm.NFC.String(name))
+}
+
+// renameNoReplace renames oldpath to newpath, failing if newpath is another
+// existing entry. On case-insensitive file systems newpath can be oldpath
+// itself with a different case.
+func renameNoReplace(oldpath, newpath string) error {
+	if fi, err := os.Lstat(newpath); err == nil {
+		oldFi, err := os.Lstat(oldpath)
+		if err != nil {
+			return err
+		}
+		if !os.SameFile(fi, oldFi) {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrExist}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return os.Rename(oldpath, newpath)
+}
+
+// uniqueName returns name, or name with the lowest numeric suffix that makes
+// it unique, ignoring case and Unicode normalization, among taken.
+func uniqueName(name string, taken map[string]int, maxBytes int) string {
+	if taken[nameKey(name)] == 0 {
+		return name
+	}
+
+	stem, ext := splitLastExt(name)
+	for i := 1; ; i++ {
+		suffix := fmt.Sprintf("_%d", i)
+		candidate := truncateName(stem, "", maxBytes-len(ext)-len(suffix)) + suffix + ext
+		if taken[nameKey(candidate)] == 0 {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package fsutil_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	tfs "gotest.tools/v3/fs"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+func TestSanitizeName(t *testing.T) {
+	t.Parallel()
+
+	type test struct {
+		name string
+		in   string
+		opts fsutil.SanitizeOptions
+		want string
+	}
+
+	for _, tc := range []test{
+		{
+			name: "Keeps a valid name",
+			in:   "Informe final (v2).pdf",
+			want: "Informe final (v2).pdf",
+		},
+		{
+			name: "Replaces disallowed characters",
+			in:   "a<b>c:d\"e/f\\g|h?i*j\x00k\x1fl.txt",
+			want: "a_b_c_d_e_f_g_h_i_j_k_l.txt",
+		},
+		{
+			name: "Uses a custom replacement",
+			in:   "what?.txt",
+			opts: fsutil.SanitizeOptions{Replacement: "-"},
+			want: "what-.txt",
+		},
+		{
+			name: "Normalizes to NFC",
+			in:   "résumé.txt",
+			want: "résumé.txt",
+		},
+		{
+			name: "Transliterates to ASCII",
+			in:   "Straße Ærø résumé 日本.txt",
+			opts: fsutil.SanitizeOptions{ASCII: true},
+			want: "Strasse AEro resume __.txt",
+		},
+		{
+			name: "Replaces invalid UTF-8",
+			in:   "bad\xffname",
+			want: "bad_name",
+		},
+		{
+			name: "Removes trailing periods and spaces",
+			in:   "notes. . ",
+			want: "notes",
+		},
+		{
+			name: "Fixes reserved Windows names",
+			in:   "con.txt",
+			want: "con_.txt",
+		},
+		{
+			name: "Fixes reserved Windows names without extension",
+			in:   "LPT1",
+			want: "LPT1_",
+		},
+		{
+			name: "Fixes reserved Windows names with several extensions",
+			in:   "CON.tar.gz",
+			want: "CON_.tar.gz",
+		},
+		{
+			name: "Keeps names only starting like reserved Windows names",
+			in:   "console.tar.gz",
+			want: "console.tar.gz",
+		},
+		{
+			name: "Replaces special names",
+			in:   "..",
+			want: "_",
+		},
+		{
+			name: "Truncates long names preserving the extension",
+			in:   strings.Repeat("é", 10) + ".txt",
+			opts: fsutil.SanitizeOptions{MaxBytes: 15},
+			want: strings.Repeat("é", 5) + ".txt",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, fsutil.SanitizeName(tc.in, tc.opts), tc.want)
+		})
+	}
+}
+
+func TestSanitizeTree(t *testing.T) {
+	t.Parallel()
+
+	newTree := func(t *testing.T) *tfs.Dir {
+		return tfs.NewDir(t, "enduro-test-fsutil",
+			tfs.WithDir("dir:1",
+				tfs.WithFile("a?.txt", "1"),
+				tfs.WithFile("a_.txt", "2"),
+				tfs.WithFile("A*.TXT", "3"),
+			),
+			tfs.WithFile("ok.txt", "4"),
+		)
+	}
+
+	wantRenames := map[string]string{
+		"dir:1":                          "dir_1",
+		filepath.Join("dir:1", "a?.txt"): filepath.Join("dir_1", "a__2.txt"),
+		filepath.Join("dir:1", "A*.TXT"): filepath.Join("dir_1", "A__1.TXT"),
+	}
+
+	t.Run("Renames entries and resolves collisions", func(t *testing.T) {
+		t.Parallel()
+
+		td := newTree(t)
+
+		renames, err := fsutil.SanitizeTree(td.Path(), fsutil.SanitizeOptions{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, renames, wantRenames)
+		assert.Assert(t, tfs.Equal(td.Path(), tfs.Expected(t,
+			tfs.WithDir("dir_1",
+				tfs.WithFile("a__2.txt", "1"),
+				tfs.WithFile("a_.txt", "2"),
+				tfs.WithFile("A__1.TXT", "3"),
+			),
+			tfs.WithFile("ok.txt", "4"),
+		)))
+	})
+
+	t.Run("Reports renames in a dry run", func(t *testing.T) {
+		t.Parallel()
+
+		td := newTree(t)
+		manifest := tfs.ManifestFromDir(t, td.Path())
+
+		renames, err := fsutil.SanitizeTree(td.Path(), fsutil.SanitizeOptions{DryRun: true})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, renames, wantRenames)
+		assert.Assert(t, tfs.Equal(td.Path(), manifest))
+	})
+
+	t.Run("Keeps names that only differ in Unicode normalization", func(t *testing.T) {
+		t.Parallel()
+
+		nfc, nfd := "caf\u00e9.txt", "cafe\u0301.txt"
+		td := tfs.NewDir(t, "enduro-test-fsutil",
+			tfs.WithFile(nfc, "nfc"),
+			tfs.WithFile(nfd, "nfd"),
+		)
+
+		renames, err := fsutil.SanitizeTree(td.Path(), fsutil.SanitizeOptions{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, renames, map[string]string{nfd: "caf\u00e9_1.txt"})
+		assert.Assert(t, tfs.Equal(td.Path(), tfs.Expected(t,
+			tfs.WithFile(nfc, "nfc"),
+			tfs.WithFile("caf\u00e9_1.txt", "nfd"),
+		)))
+	})
+}
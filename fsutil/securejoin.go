@@ -0,0 +1,166 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSymlinks is the maximum number of symbolic links resolved by SecureJoin,
+// like the Linux limit.
+const maxSymlinks = 40
+
+// ErrEscapesRoot is returned when a path refers to a location outside a root
+// directory.
+var ErrEscapesRoot = errors.New("path escapes root")
+
+// SecureJoin joins the relative path unsafePath, e.g. supplied by a user, to
+// the directory root, resolving symbolic links as if root were the file system
+// root. It returns an error wrapping ErrEscapesRoot if unsafePath is absolute,
+// if it goes above root with ".." elements or if it goes through a symbolic
+// link whose target is absolute or outside root. Elements of unsafePath that
+// don't exist are joined as is.
+//
+// The returned path is only safe until the tree is modified, e.g. a directory
+// replaced with a symbolic link. Use a [RootFS] to guard against concurrent
+// modifications.
+func SecureJoin(root, unsafePath string) (string, error) {
+	resolved, err := resolveInRoot(root, unsafePath)
+	if err != nil {
+		return "", fmt.Errorf("secure join %s: %w", unsafePath, err)
+	}
+	return filepath.Join(root, resolved), nil
+}
+
+// resolveInRoot resolves the symbolic links of the relative path p in root,
+// returning the resolved relative path.
+func resolveInRoot(root, p string) (string, error) {
+	if p == "" {
+		return ".", nil
+	}
+	if !filepath.IsLocal(p) {
+		return "", ErrEscapesRoot
+	}
+
+	var (
+		resolved string
+		pending  = splitPath(p)
+		links    int
+	)
+	for len(pending) > 0 {
+		elem := pending[0]
+		pending = pending[1:]
+
+		switch elem {
+		case ".", "":
+			continue
+		case "..":
+			// Resolved paths don't have symbolic links, so their parent
+			// is found lexically.
+			if resolved == "" {
+				return "", ErrEscapesRoot
+			}
+			resolved = filepath.Dir(resolved)
+			if resolved == "." {
+				resolved = ""
+			}
+			continue
+		}
+
+		next := filepath.Join(resolved, elem)
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if errors.Is(err, fs.ErrNotExist) {
+			// The rest of the path doesn't exist so it can't contain
+			// symbolic links, but it can still escape with "..".
+			rest := filepath.Join(append([]string{next}, pending...)...)
+			if !filepath.IsLocal(rest) {
+				return "", ErrEscapesRoot
+			}
+			return rest, nil
+		} else if err != nil {
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", errors.New("too many levels of symbolic links")
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) || filepath.VolumeName(target) != "" ||
+			target != "" && os.IsPathSeparator(target[0]) {
+			return "", ErrEscapesRoot
+		}
+		pending = append(splitPath(target), pending...)
+	}
+
+	if resolved == "" {
+		return ".", nil
+	}
+	return resolved, nil
+}
+
+// splitPath splits p into its elements without cleaning it, as ".." elements
+// must be resolved after the symbolic links preceding them.
+func splitPath(p string) []string {
+	return strings.Split(filepath.FromSlash(p), string(filepath.Separator))
+}
+
+// WithinRoot reports whether path, once its symbolic links are resolved, is
+// the directory root or one of its descendants. Non-existent trailing elements
+// of path are resolved lexically.
+func WithinRoot(root, path string) (bool, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false, err
+	}
+	realRoot, err = filepath.Abs(realRoot)
+	if err != nil {
+		return false, err
+	}
+	realPath, err := evalExistingSymlinks(path)
+	if err != nil {
+		return false, err
+	}
+
+	rel, err := filepath.Rel(realRoot, realPath)
+	if err != nil {
+		return false, nil
+	}
+	return filepath.IsLocal(rel), nil
+}
+
+// evalExistingSymlinks returns the absolute path of p with the symbolic links
+// of its longest existing prefix resolved.
+func evalExistingSymlinks(p string) (string, error) {
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+
+	var rest []string
+	for {
+		real, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(append([]string{real}, rest...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return "", err
+		}
+		rest = append([]string{filepath.Base(p)}, rest...)
+		p = parent
+	}
+}
@@ -0,0 +1,154 @@
+package fsutil_test
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	tfs "gotest.tools/v3/fs"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+// newRootTree returns a directory with a "root" tree holding symbolic links
+// pointing inside and outside of it.
+func newRootTree(t *testing.T) *tfs.Dir {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+
+	td := tfs.NewDir(t, "enduro-test-fsutil",
+		tfs.WithDir("root",
+			tfs.WithDir("a", tfs.WithDir("b", tfs.WithFile("c.txt", "c"))),
+		),
+		tfs.WithFile("secret.txt", "secret"),
+	)
+	for link, target := range map[string]string{
+		"root/inside":     "a/b",
+		"root/a/up":       "../a",
+		"root/outside":    "../secret.txt",
+		"root/a/absolute": td.Join("secret.txt"),
+		"root/loop":       "loop",
+	} {
+		assert.NilError(t, os.Symlink(target, td.Join(filepath.FromSlash(link))))
+	}
+
+	return td
+}
+
+func TestSecureJoin(t *testing.T) {
+	t.Parallel()
+
+	td := newRootTree(t)
+	root := td.Join("root")
+
+	type test struct {
+		path    string
+		want    string
+		wantErr string
+	}
+	for _, tc := range []test{
+		{path: "", want: root},
+		{path: "a/b/c.txt", want: filepath.Join(root, "a", "b", "c.txt")},
+		{path: "inside/c.txt", want: filepath.Join(root, "a", "b", "c.txt")},
+		{path: "a/up/b", want: filepath.Join(root, "a", "b")},
+		{path: "inside/../b", want: filepath.Join(root, "a", "b")},
+		{path: "a/missing/../new.txt", want: filepath.Join(root, "a", "new.txt")},
+		{path: "../secret.txt", wantErr: "secure join ../secret.txt: path escapes root"},
+		{path: "a/../../secret.txt", wantErr: "path escapes root"},
+		{path: td.Join("secret.txt"), wantErr: "path escapes root"},
+		{path: "outside", wantErr: "path escapes root"},
+		{path: "a/absolute", wantErr: "path escapes root"},
+		{path: "inside/../../../secret.txt", wantErr: "path escapes root"},
+		{path: "loop", wantErr: "too many levels of symbolic links"},
+	} {
+		t.Run("Joins "+tc.path, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := fsutil.SecureJoin(root, filepath.FromSlash(tc.path))
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, got, tc.want)
+		})
+	}
+
+	_, err := fsutil.SecureJoin(root, "outside")
+	assert.ErrorIs(t, err, fsutil.ErrEscapesRoot)
+}
+
+func TestWithinRoot(t *testing.T) {
+	t.Parallel()
+
+	td := newRootTree(t)
+	root := td.Join("root")
+
+	type test struct {
+		path string
+		want bool
+	}
+	for _, tc := range []test{
+		{path: "root", want: true},
+		{path: "root/a/b/c.txt", want: true},
+		{path: "root/inside/missing/file", want: true},
+		{path: "root/outside", want: false},
+		{path: "root/a/absolute", want: false},
+		{path: "secret.txt", want: false},
+		{path: "root/../secret.txt", want: false},
+	} {
+		t.Run("Checks "+tc.path, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := fsutil.WithinRoot(root, td.Join(filepath.FromSlash(tc.path)))
+			assert.NilError(t, err)
+			assert.Equal(t, got, tc.want)
+		})
+	}
+}
+
+func TestRootFS(t *testing.T) {
+	t.Parallel()
+
+	td := newRootTree(t)
+	fsys, err := fsutil.OpenRootFS(td.Join("root"))
+	assert.NilError(t, err)
+	t.Cleanup(func() { fsys.Close() })
+
+	t.Run("Operates inside the root", func(t *testing.T) {
+		data, err := fs.ReadFile(fsys, "inside/c.txt")
+		assert.NilError(t, err)
+		assert.Equal(t, string(data), "c")
+
+		w, err := fsys.Create("a/new.txt")
+		assert.NilError(t, err)
+		_, err = io.WriteString(w, "new")
+		assert.NilError(t, err)
+		assert.NilError(t, w.Close())
+
+		assert.NilError(t, fsutil.MoveFS(fsys, "a/new.txt", "moved.txt"))
+		assert.Assert(t, fsutil.FileExists(td.Join("root", "moved.txt")))
+		assert.NilError(t, fsutil.SetFileModesFS(fsys, "a/b", 0o700, 0o600))
+	})
+
+	t.Run("Rejects escaping paths", func(t *testing.T) {
+		_, err := fsys.Open("outside")
+		assert.ErrorContains(t, err, "path escapes from parent")
+
+		_, err = fsys.Create("a/absolute")
+		assert.ErrorContains(t, err, "path escapes from parent")
+
+		_, err = fsys.Open("../secret.txt")
+		assert.ErrorIs(t, err, fs.ErrInvalid)
+
+		assert.ErrorContains(t, fsys.Rename("a", "outside/a"), "path escapes from parent")
+		assert.Assert(t, fsutil.FileExists(td.Join("secret.txt")))
+	})
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package fsutil
+
+import "io/fs"
+
+// fileOwner is not supported on this platform.
+func fileOwner(fi fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// fileIdentity is not supported on this platform.
+func fileIdentity(fi fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
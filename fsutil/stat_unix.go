@@ -0,0 +1,26 @@
+//go:build unix
+
+package fsutil
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileOwner returns the numeric user and group IDs of the owner of fi.
+func fileOwner(fi fs.FileInfo) (uid, gid int, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+// fileIdentity returns the identity of fi when it has multiple hard links.
+func fileIdentity(fi fs.FileInfo) (fileID, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd)
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+)
+
+// FreeSpace is not supported on this platform, it returns an error wrapping
+// [errors.ErrUnsupported].
+func FreeSpace(path string) (SpaceInfo, error) {
+	return SpaceInfo{}, &os.PathError{Op: "statfs", Path: path, Err: errors.ErrUnsupported}
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin || freebsd
+
+package fsutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// FreeSpace returns the space of the file system containing path.
+func FreeSpace(path string) (SpaceInfo, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return SpaceInfo{}, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+
+	bsize := uint64(st.Bsize)
+	return SpaceInfo{
+		Total: uint64(st.Blocks) * bsize,
+		Free:  uint64(st.Bavail) * bsize,
+	}, nil
+}
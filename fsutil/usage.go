@@ -0,0 +1,140 @@
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrInsufficientSpace is returned when a destination file system doesn't
+// have enough free space.
+var ErrInsufficientSpace = errors.New("insufficient free space")
+
+// Usage is the disk usage of a file system tree.
+type Usage struct {
+	// Size is the total size in bytes of the regular files.
+	Size int64
+	// Files is the number of regular files.
+	Files int64
+	// Dirs is the number of directories, including the root.
+	Dirs int64
+}
+
+// SpaceInfo describes the space of a file system.
+type SpaceInfo struct {
+	// Total is the size of the file system in bytes.
+	Total uint64
+	// Free is the number of bytes available to unprivileged users.
+	Free uint64
+}
+
+// DirUsage returns the total size and number of files of the tree at root,
+// which can also be a single file. Directories are read concurrently and
+// symbolic links aren't followed. Files with multiple hard links in the tree
+// are only counted once on platforms that expose inode numbers.
+func DirUsage(ctx context.Context, root string) (Usage, error) {
+	fi, err := os.Lstat(root)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	u := &usageCounter{seen: map[fileID]bool{}}
+	if !fi.IsDir() {
+		u.add(fi)
+		return u.usage, nil
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(runtime.GOMAXPROCS(0))
+	u.addDir()
+	g.Go(func() error { return u.walk(ctx, g, root) })
+	if err := g.Wait(); err != nil {
+		return Usage{}, err
+	}
+
+	return u.usage, nil
+}
+
+// fileID identifies a file by device and inode numbers.
+type fileID struct {
+	dev, ino uint64
+}
+
+// usageCounter accumulates the usage of a tree walked concurrently.
+type usageCounter struct {
+	mu    sync.Mutex
+	usage Usage
+	seen  map[fileID]bool
+}
+
+// walk counts the entries of the directory at dir, walking subdirectories in
+// new goroutines when the group limit allows it.
+func (u *usageCounter) walk(ctx context.Context, g *errgroup.Group, dir string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.IsDir() {
+			u.addDir()
+			if !g.TryGo(func() error { return u.walk(ctx, g, path) }) {
+				if err := u.walk(ctx, g, path); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !e.Type().IsRegular() {
+			continue
+		}
+
+		fi, err := e.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		u.add(fi)
+	}
+
+	return nil
+}
+
+func (u *usageCounter) addDir() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.usage.Dirs++
+}
+
+// add counts the regular file fi unless it's a hard link to a file already
+// counted.
+func (u *usageCounter) add(fi fs.FileInfo) {
+	if !fi.Mode().IsRegular() {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if id, ok := fileIdentity(fi); ok {
+		if u.seen[id] {
+			return
+		}
+		u.seen[id] = true
+	}
+	u.usage.Size += fi.Size()
+	u.usage.Files++
+}
@@ -0,0 +1,90 @@
+package fsutil_test
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	tfs "gotest.tools/v3/fs"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+func TestDirUsage(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Computes the usage of a tree", func(t *testing.T) {
+		t.Parallel()
+
+		td := tfs.NewDir(t, "enduro-test-fsutil",
+			tfs.WithFile("a.txt", "abc"),
+			tfs.WithDir("b",
+				tfs.WithFile("c.txt", "defg"),
+				tfs.WithDir("d", tfs.WithFile("e.txt", "hi")),
+				tfs.WithDir("empty"),
+			),
+			tfs.WithSymlink("link", "a.txt"),
+		)
+
+		usage, err := fsutil.DirUsage(context.Background(), td.Path())
+		assert.NilError(t, err)
+		assert.Equal(t, usage, fsutil.Usage{Size: 9, Files: 3, Dirs: 4})
+	})
+
+	t.Run("Counts hard linked files once", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS == "windows" {
+			t.Skip("hard links aren't de-duplicated on Windows")
+		}
+
+		td := tfs.NewDir(t, "enduro-test-fsutil",
+			tfs.WithFile("a.txt", "abc"),
+			tfs.WithDir("b"),
+		)
+		assert.NilError(t, os.Link(td.Join("a.txt"), td.Join("b", "a.txt")))
+
+		usage, err := fsutil.DirUsage(context.Background(), td.Path())
+		assert.NilError(t, err)
+		assert.Equal(t, usage, fsutil.Usage{Size: 3, Files: 1, Dirs: 2})
+	})
+
+	t.Run("Computes the usage of a file", func(t *testing.T) {
+		t.Parallel()
+
+		td := tfs.NewDir(t, "enduro-test-fsutil", tfs.WithFile("a.txt", "abc"))
+
+		usage, err := fsutil.DirUsage(context.Background(), td.Join("a.txt"))
+		assert.NilError(t, err)
+		assert.Equal(t, usage, fsutil.Usage{Size: 3, Files: 1})
+	})
+
+	t.Run("Fails when the context is canceled", func(t *testing.T) {
+		t.Parallel()
+
+		td := tfs.NewDir(t, "enduro-test-fsutil", tfs.WithDir("a"))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := fsutil.DirUsage(ctx, td.Path())
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestFreeSpace(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" {
+		t.Skip("free space isn't supported on " + runtime.GOOS)
+	}
+
+	space, err := fsutil.FreeSpace(t.TempDir())
+	assert.NilError(t, err)
+	assert.Assert(t, space.Total > 0)
+	assert.Assert(t, space.Free <= space.Total)
+
+	_, err = fsutil.FreeSpace("/missing/dir")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
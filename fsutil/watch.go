@@ -0,0 +1,318 @@
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultWatchQuietPeriod  = 5 * time.Second
+	defaultWatchPollInterval = time.Second
+	defaultWatchDebounce     = 100 * time.Millisecond
+)
+
+// WatchEvent reports that a watched entry became stable.
+type WatchEvent struct {
+	// Path of the entry.
+	Path string
+	// IsDir is true when the entry is a directory.
+	IsDir bool
+	// Size is the size of the entry in bytes; the total size of the files
+	// it contains for a directory.
+	Size int64
+	// Files is the number of files in a directory, or 1 for a file.
+	Files int
+	// ModTime is the latest modification time of the entry or its contents.
+	ModTime time.Time
+}
+
+// WatcherOptions configures a [Watcher].
+type WatcherOptions struct {
+	// QuietPeriod is the time an entry must go without any size or
+	// modification time change to be considered stable. Defaults to 5s.
+	QuietPeriod time.Duration
+	// PollInterval is the time between scans when file system notifications
+	// aren't available or ForcePolling is set. Defaults to 1s.
+	PollInterval time.Duration
+	// Debounce delays the scan triggered by a file system notification so
+	// bursts of notifications cause a single scan. Defaults to 100ms.
+	Debounce time.Duration
+	// Recursive reports every file in the watched directory tree instead of
+	// the entries directly in the watched directory.
+	Recursive bool
+	// ForcePolling disables file system notifications, e.g. for network
+	// file systems that don't support them.
+	ForcePolling bool
+}
+
+func (o *WatcherOptions) setDefaults() {
+	if o.QuietPeriod <= 0 {
+		o.QuietPeriod = defaultWatchQuietPeriod
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaultWatchPollInterval
+	}
+	if o.Debounce <= 0 {
+		o.Debounce = defaultWatchDebounce
+	}
+}
+
+// Watcher watches a directory, e.g. an Archivematica-style "watched
+// directory", and emits an event once for every entry that becomes stable,
+// i.e. when neither its size nor its modification time have changed for the
+// quiet period. By default the entries directly in the directory are watched,
+// with the stability of subdirectories computed over their whole contents.
+//
+// On Linux the Watcher relies on inotify notifications to detect changes and
+// falls back to polling when inotify is unavailable, e.g. when the watch limit
+// is reached. Other platforms always poll.
+//
+//	w, err := fsutil.NewWatcher(dir, fsutil.WatcherOptions{})
+//	if err != nil {
+//		return err
+//	}
+//	go func() {
+//		for ev := range w.Events() {
+//			// ... process ev.Path.
+//		}
+//	}()
+//	return w.Run(ctx)
+type Watcher struct {
+	dir    string
+	opts   WatcherOptions
+	events chan WatchEvent
+	units  map[string]*watchUnit
+}
+
+// watchUnit tracks the stability of a watched entry.
+type watchUnit struct {
+	sig     watchSignature
+	changed time.Time
+	emitted bool
+}
+
+// watchSignature summarizes the state of a watched entry.
+type watchSignature struct {
+	isDir bool
+	size  int64
+	files int
+	mtime time.Time
+}
+
+// NewWatcher returns a Watcher for the directory at dir.
+func NewWatcher(dir string, opts WatcherOptions) (*Watcher, error) {
+	opts.setDefaults()
+
+	if fi, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, errors.New("watcher: " + dir + " is not a directory")
+	}
+
+	return &Watcher{
+		dir:    dir,
+		opts:   opts,
+		events: make(chan WatchEvent),
+		units:  map[string]*watchUnit{},
+	}, nil
+}
+
+// Events returns the channel on which stable entries are reported. It is
+// closed when Run returns. Events must be received for Run to make progress.
+func (w *Watcher) Events() <-chan WatchEvent {
+	return w.events
+}
+
+// Run watches the directory until ctx is done, returning nil, or until the
+// watched directory can't be read, returning the error. Run must only be
+// called once.
+func (w *Watcher) Run(ctx context.Context) error {
+	defer close(w.events)
+
+	var n notifier
+	if !w.opts.ForcePolling {
+		n, _ = newNotifier()
+	}
+	defer func() {
+		if n != nil {
+			n.close()
+		}
+	}()
+
+	var notifications <-chan struct{}
+	poll := time.NewTicker(w.opts.PollInterval)
+	defer poll.Stop()
+	if n != nil {
+		notifications = n.notifications()
+		poll.Stop()
+	}
+
+	// The timer fires at the next stability deadline, or after a debounced
+	// notification.
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	debouncing := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-notifications:
+			if !debouncing {
+				timer.Reset(w.opts.Debounce)
+				debouncing = true
+			}
+			continue
+		case <-poll.C:
+		case <-timer.C:
+		}
+		debouncing = false
+
+		dirs, err := w.scan(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if n != nil {
+			for _, d := range dirs {
+				if err := n.add(d); err != nil {
+					// Fall back to polling.
+					n.close()
+					n, notifications = nil, nil
+					poll.Reset(w.opts.PollInterval)
+					break
+				}
+			}
+		}
+
+		if next, ok := w.nextDeadline(); ok {
+			timer.Reset(max(time.Until(next), 0))
+		}
+	}
+}
+
+// scan updates the state of the watched entries, emits the events of the
+// stable ones and returns the directories found in the watched tree.
+func (w *Watcher) scan(ctx context.Context) ([]string, error) {
+	sigs := map[string]watchSignature{}
+	dirs := []string{w.dir}
+
+	err := filepath.WalkDir(w.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == w.dir {
+				return err
+			}
+			// Entries can disappear while scanning.
+			return nil
+		}
+		if path == w.dir {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+		}
+
+		unit := path
+		if !w.opts.Recursive {
+			rel, _ := filepath.Rel(w.dir, path)
+			unit = filepath.Join(w.dir, firstElem(rel))
+		} else if d.IsDir() {
+			return nil
+		}
+
+		sig := sigs[unit]
+		sig.isDir = sig.isDir || (unit == path && d.IsDir())
+		if !d.IsDir() {
+			sig.size += fi.Size()
+			sig.files++
+		}
+		if fi.ModTime().After(sig.mtime) {
+			sig.mtime = fi.ModTime()
+		}
+		sigs[unit] = sig
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for path := range w.units {
+		if _, ok := sigs[path]; !ok {
+			delete(w.units, path)
+		}
+	}
+	for path, sig := range sigs {
+		u, ok := w.units[path]
+		if !ok {
+			u = &watchUnit{sig: sig, changed: now}
+			w.units[path] = u
+		} else if u.sig != sig {
+			u.sig, u.changed, u.emitted = sig, now, false
+		}
+		if u.emitted || now.Sub(u.changed) < w.opts.QuietPeriod {
+			continue
+		}
+
+		select {
+		case w.events <- WatchEvent{
+			Path:    path,
+			IsDir:   sig.isDir,
+			Size:    sig.size,
+			Files:   sig.files,
+			ModTime: sig.mtime,
+		}:
+			u.emitted = true
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return dirs, nil
+}
+
+// nextDeadline returns the earliest time at which a pending entry becomes
+// stable.
+func (w *Watcher) nextDeadline() (time.Time, bool) {
+	var next time.Time
+	for _, u := range w.units {
+		if u.emitted {
+			continue
+		}
+		if d := u.changed.Add(w.opts.QuietPeriod); next.IsZero() || d.Before(next) {
+			next = d
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// firstElem returns the first element of the relative path p.
+func firstElem(p string) string {
+	for i := 0; i < len(p); i++ {
+		if os.IsPathSeparator(p[i]) {
+			return p[:i]
+		}
+	}
+	return p
+}
+
+// notifier delivers file system change notifications.
+type notifier interface {
+	// add watches the directory at path, it's a no-op for directories
+	// already watched.
+	add(path string) error
+	// notifications signals that a change happened in a watched directory.
+	notifications() <-chan struct{}
+	close() error
+}
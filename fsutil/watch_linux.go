@@ -0,0 +1,111 @@
+package fsutil
+
+import (
+	"encoding/binary"
+	"maps"
+	"os"
+	"sync"
+	"syscall"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE | syscall.IN_DELETE_SELF
+
+// inotifyNotifier is a notifier based on Linux's inotify API.
+type inotifyNotifier struct {
+	f       *os.File
+	ch      chan struct{}
+	mu      sync.Mutex
+	watched map[string]int32 // Watch descriptors by path.
+	once    sync.Once
+}
+
+func newNotifier() (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	// A non-blocking file descriptor is registered with the runtime poller,
+	// so closing the file unblocks pending reads.
+	n := &inotifyNotifier{
+		f:       os.NewFile(uintptr(fd), "inotify"),
+		ch:      make(chan struct{}, 1),
+		watched: map[string]int32{},
+	}
+	go n.read()
+
+	return n, nil
+}
+
+func (n *inotifyNotifier) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		nr, err := n.f.Read(buf)
+		if err != nil {
+			return
+		}
+		// The events themselves aren't needed as the watcher rescans, but
+		// the watches removed by the kernel must be forgotten so directories
+		// recreated with the same path are watched again.
+		for b := buf[:nr]; len(b) >= syscall.SizeofInotifyEvent; {
+			wd := int32(binary.NativeEndian.Uint32(b[0:]))
+			mask := binary.NativeEndian.Uint32(b[4:])
+			size := syscall.SizeofInotifyEvent + int(binary.NativeEndian.Uint32(b[12:]))
+			if mask&syscall.IN_IGNORED != 0 {
+				n.forget(wd)
+			}
+			b = b[min(size, len(b)):]
+		}
+		select {
+		case n.ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (n *inotifyNotifier) add(path string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.watched[path]; ok {
+		return nil
+	}
+	sc, err := n.f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var wd int
+	var werr error
+	err = sc.Control(func(fd uintptr) {
+		wd, werr = syscall.InotifyAddWatch(int(fd), path, inotifyMask)
+	})
+	if err != nil {
+		return err
+	}
+	if werr != nil {
+		return os.NewSyscallError("inotify_add_watch", werr)
+	}
+	n.watched[path] = int32(wd)
+
+	return nil
+}
+
+// forget forgets the paths watched with the watch descriptor wd.
+func (n *inotifyNotifier) forget(wd int32) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	maps.DeleteFunc(n.watched, func(_ string, w int32) bool { return w == wd })
+}
+
+func (n *inotifyNotifier) notifications() <-chan struct{} {
+	return n.ch
+}
+
+func (n *inotifyNotifier) close() error {
+	var err error
+	n.once.Do(func() { err = n.f.Close() })
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package fsutil
+
+import "errors"
+
+// newNotifier is not supported on this platform, watchers poll instead.
+func newNotifier() (notifier, error) {
+	return nil, errors.ErrUnsupported
+}
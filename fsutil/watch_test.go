@@ -0,0 +1,184 @@
+package fsutil_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	tfs "gotest.tools/v3/fs"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+func TestWatcher(t *testing.T) {
+	t.Parallel()
+
+	// runWatcher runs a watcher on dir and returns its events channel.
+	runWatcher := func(t *testing.T, dir string, opts fsutil.WatcherOptions) <-chan fsutil.WatchEvent {
+		t.Helper()
+
+		w, err := fsutil.NewWatcher(dir, opts)
+		assert.NilError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- w.Run(ctx) }()
+		t.Cleanup(func() {
+			cancel()
+			assert.NilError(t, <-done)
+		})
+
+		return w.Events()
+	}
+
+	receive := func(t *testing.T, events <-chan fsutil.WatchEvent) fsutil.WatchEvent {
+		t.Helper()
+
+		select {
+		case ev, ok := <-events:
+			assert.Assert(t, ok, "events channel closed")
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+		return fsutil.WatchEvent{}
+	}
+
+	for _, polling := range []bool{false, true} {
+		name := "inotify"
+		if polling {
+			name = "polling"
+		}
+
+		t.Run("Emits stable directories once ("+name+")", func(t *testing.T) {
+			t.Parallel()
+
+			td := tfs.NewDir(t, "enduro-test-fsutil")
+			events := runWatcher(t, td.Path(), fsutil.WatcherOptions{
+				QuietPeriod:  200 * time.Millisecond,
+				PollInterval: 20 * time.Millisecond,
+				Debounce:     10 * time.Millisecond,
+				ForcePolling: polling,
+			})
+
+			assert.NilError(t, os.MkdirAll(td.Join("transfer", "objects"), 0o755))
+			assert.NilError(t, os.WriteFile(td.Join("transfer", "objects", "a.txt"), []byte("abc"), 0o644))
+			start := time.Now()
+			assert.NilError(t, os.WriteFile(td.Join("transfer", "b.txt"), []byte("de"), 0o644))
+
+			ev := receive(t, events)
+			assert.Assert(t, time.Since(start) >= 200*time.Millisecond)
+			assert.Equal(t, ev.Path, td.Join("transfer"))
+			assert.Equal(t, ev.IsDir, true)
+			assert.Equal(t, ev.Size, int64(5))
+			assert.Equal(t, ev.Files, 2)
+
+			select {
+			case ev := <-events:
+				t.Fatalf("unexpected event: %v", ev)
+			case <-time.After(400 * time.Millisecond):
+			}
+		})
+
+		t.Run("Waits for files to stop changing ("+name+")", func(t *testing.T) {
+			t.Parallel()
+
+			td := tfs.NewDir(t, "enduro-test-fsutil")
+			events := runWatcher(t, td.Path(), fsutil.WatcherOptions{
+				QuietPeriod:  300 * time.Millisecond,
+				PollInterval: 20 * time.Millisecond,
+				Debounce:     10 * time.Millisecond,
+				ForcePolling: polling,
+			})
+
+			f, err := os.Create(td.Join("upload.zip"))
+			assert.NilError(t, err)
+			defer f.Close()
+			var last time.Time
+			for range 5 {
+				_, err := f.Write([]byte("data"))
+				assert.NilError(t, err)
+				last = time.Now()
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			ev := receive(t, events)
+			assert.Assert(t, time.Since(last) >= 300*time.Millisecond)
+			assert.Equal(t, ev.Path, td.Join("upload.zip"))
+			assert.Equal(t, ev.IsDir, false)
+			assert.Equal(t, ev.Size, int64(20))
+			assert.Equal(t, ev.Files, 1)
+		})
+	}
+
+	t.Run("Emits every file when recursive", func(t *testing.T) {
+		t.Parallel()
+
+		td := tfs.NewDir(t, "enduro-test-fsutil",
+			tfs.WithDir("a", tfs.WithFile("1.txt", "1")),
+			tfs.WithDir("b", tfs.WithDir("c", tfs.WithFile("2.txt", "22"))),
+		)
+		events := runWatcher(t, td.Path(), fsutil.WatcherOptions{
+			QuietPeriod:  50 * time.Millisecond,
+			PollInterval: 20 * time.Millisecond,
+			Recursive:    true,
+		})
+
+		got := map[string]int64{}
+		for range 2 {
+			ev := receive(t, events)
+			rel, err := filepath.Rel(td.Path(), ev.Path)
+			assert.NilError(t, err)
+			got[rel] = ev.Size
+		}
+		assert.DeepEqual(t, got, map[string]int64{
+			filepath.Join("a", "1.txt"):      1,
+			filepath.Join("b", "c", "2.txt"): 2,
+		})
+	})
+
+	t.Run("Watches recreated directories when recursive", func(t *testing.T) {
+		t.Parallel()
+
+		td := tfs.NewDir(t, "enduro-test-fsutil", tfs.WithDir("sub", tfs.WithFile("first", "1")))
+		events := runWatcher(t, td.Path(), fsutil.WatcherOptions{
+			QuietPeriod: 50 * time.Millisecond,
+			Debounce:    10 * time.Millisecond,
+			Recursive:   true,
+		})
+		assert.Equal(t, receive(t, events).Path, td.Join("sub", "first"))
+
+		assert.NilError(t, os.RemoveAll(td.Join("sub")))
+		assert.NilError(t, os.Mkdir(td.Join("sub"), 0o755))
+		// Let the watcher scan the new directory before writing to it.
+		time.Sleep(200 * time.Millisecond)
+		assert.NilError(t, os.WriteFile(td.Join("sub", "second"), []byte("2"), 0o644))
+
+		assert.Equal(t, receive(t, events).Path, td.Join("sub", "second"))
+	})
+
+	t.Run("Closes events when the context is canceled", func(t *testing.T) {
+		t.Parallel()
+
+		td := tfs.NewDir(t, "enduro-test-fsutil")
+		w, err := fsutil.NewWatcher(td.Path(), fsutil.WatcherOptions{})
+		assert.NilError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.NilError(t, w.Run(ctx))
+
+		_, ok := <-w.Events()
+		assert.Equal(t, ok, false)
+	})
+
+	t.Run("Fails when the directory doesn't exist", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := fsutil.NewWatcher(filepath.Join(t.TempDir(), "missing"), fsutil.WatcherOptions{})
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,180 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultWorkspacePrefix is the default prefix of workspace directory names.
+const defaultWorkspacePrefix = "workspace-"
+
+// WorkspaceOptions configures a [WorkspaceManager].
+type WorkspaceOptions struct {
+	// Root is the directory where workspaces are created, which is created
+	// if needed. Defaults to os.TempDir().
+	Root string
+	// Prefix is prepended to the name of workspace directories, and used by
+	// Sweep to recognize them. Defaults to "workspace-".
+	Prefix string
+}
+
+func (o *WorkspaceOptions) setDefaults() {
+	if o.Root == "" {
+		o.Root = os.TempDir()
+	}
+	if o.Prefix == "" {
+		o.Prefix = defaultWorkspacePrefix
+	}
+}
+
+// WorkspaceManager creates temporary workspace directories and tracks them so
+// they're removed on Close, which callers should defer so workspaces are also
+// removed when a panic unwinds the stack. Workspaces leaked by processes that
+// were killed can be removed with Sweep on startup.
+//
+//	wm, err := fsutil.NewWorkspaceManager(fsutil.WorkspaceOptions{Root: cfg.WorkDir})
+//	if err != nil {
+//		return err
+//	}
+//	defer wm.Close()
+//
+//	dir, err := wm.Create("extract")
+//
+// A WorkspaceManager is safe for concurrent use.
+type WorkspaceManager struct {
+	opts WorkspaceOptions
+
+	mu     sync.Mutex
+	dirs   map[string]bool
+	closed bool
+}
+
+// NewWorkspaceManager returns a WorkspaceManager, creating its root directory
+// if needed.
+func NewWorkspaceManager(opts WorkspaceOptions) (*WorkspaceManager, error) {
+	opts.setDefaults()
+
+	if err := os.MkdirAll(opts.Root, 0o700); err != nil {
+		return nil, fmt.Errorf("workspace: %v", err)
+	}
+
+	return &WorkspaceManager{opts: opts, dirs: map[string]bool{}}, nil
+}
+
+// Root returns the directory where workspaces are created.
+func (m *WorkspaceManager) Root() string {
+	return m.opts.Root
+}
+
+// Create creates a new workspace directory whose name starts with the prefix
+// and name, followed by a random string, and returns its path. The name can't
+// contain path separators.
+func (m *WorkspaceManager) Create(name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) || strings.Contains(name, "*") {
+		return "", fmt.Errorf("workspace: invalid name %q", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return "", errors.New("workspace: manager is closed")
+	}
+
+	pattern := m.opts.Prefix + name + "-*"
+	if name == "" {
+		pattern = m.opts.Prefix + "*"
+	}
+	dir, err := os.MkdirTemp(m.opts.Root, pattern)
+	if err != nil {
+		return "", fmt.Errorf("workspace: %v", err)
+	}
+	m.dirs[dir] = true
+
+	return dir, nil
+}
+
+// Remove removes the workspace directory at dir, which must have been created
+// by m, and stops tracking it.
+func (m *WorkspaceManager) Remove(dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dirs[dir] {
+		return fmt.Errorf("workspace: %s is not a workspace", dir)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("workspace: %v", err)
+	}
+	delete(m.dirs, dir)
+
+	return nil
+}
+
+// Close removes every workspace directory that hasn't been removed yet. The
+// manager can't create workspaces afterwards.
+func (m *WorkspaceManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+
+	var errs []error
+	for dir := range m.dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, fmt.Errorf("workspace: %v", err))
+			continue
+		}
+		delete(m.dirs, dir)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Sweep removes the orphaned workspace directories in the root directory, i.e.
+// the directories whose name starts with the prefix, that aren't tracked by m
+// and that haven't been modified for longer than olderThan. It returns the
+// paths of the removed directories.
+//
+// The modification time of a directory only changes when entries are added to
+// or removed from it, so olderThan should exceed the longest time a workspace
+// is expected to be used by another manager sharing the root directory.
+func (m *WorkspaceManager) Sweep(olderThan time.Duration) ([]string, error) {
+	entries, err := os.ReadDir(m.opts.Root)
+	if err != nil {
+		return nil, fmt.Errorf("workspace: sweep: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var (
+		removed []string
+		errs    []error
+	)
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), m.opts.Prefix) {
+			continue
+		}
+		dir := filepath.Join(m.opts.Root, e.Name())
+		if m.dirs[dir] {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil || time.Since(fi.ModTime()) <= olderThan {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, fmt.Errorf("workspace: sweep: %v", err))
+			continue
+		}
+		removed = append(removed, dir)
+	}
+
+	return removed, errors.Join(errs...)
+}
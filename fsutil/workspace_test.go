@@ -0,0 +1,105 @@
+package fsutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	tfs "gotest.tools/v3/fs"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+func TestWorkspaceManager(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Creates and removes workspaces", func(t *testing.T) {
+		t.Parallel()
+
+		root := filepath.Join(t.TempDir(), "work")
+		wm, err := fsutil.NewWorkspaceManager(fsutil.WorkspaceOptions{Root: root})
+		assert.NilError(t, err)
+		assert.Equal(t, wm.Root(), root)
+
+		dir1, err := wm.Create("extract")
+		assert.NilError(t, err)
+		assert.Equal(t, filepath.Dir(dir1), root)
+		assert.Assert(t, strings.HasPrefix(filepath.Base(dir1), "workspace-extract-"))
+		assert.NilError(t, os.WriteFile(filepath.Join(dir1, "a.txt"), []byte("a"), 0o600))
+
+		dir2, err := wm.Create("")
+		assert.NilError(t, err)
+
+		assert.NilError(t, wm.Remove(dir2))
+		assert.Assert(t, !fsutil.FileExists(dir2))
+		assert.ErrorContains(t, wm.Remove(dir2), "is not a workspace")
+
+		assert.NilError(t, wm.Close())
+		assert.Assert(t, !fsutil.FileExists(dir1))
+		assert.Assert(t, fsutil.FileExists(root))
+
+		_, err = wm.Create("extract")
+		assert.Error(t, err, "workspace: manager is closed")
+	})
+
+	t.Run("Removes workspaces when panicking", func(t *testing.T) {
+		t.Parallel()
+
+		wm, err := fsutil.NewWorkspaceManager(fsutil.WorkspaceOptions{Root: t.TempDir()})
+		assert.NilError(t, err)
+
+		var dir string
+		func() {
+			defer func() { _ = recover() }()
+			defer wm.Close()
+
+			dir, err = wm.Create("process")
+			assert.NilError(t, err)
+			panic("boom")
+		}()
+
+		assert.Assert(t, !fsutil.FileExists(dir))
+	})
+
+	t.Run("Rejects invalid names", func(t *testing.T) {
+		t.Parallel()
+
+		wm, err := fsutil.NewWorkspaceManager(fsutil.WorkspaceOptions{Root: t.TempDir()})
+		assert.NilError(t, err)
+
+		_, err = wm.Create("../escape")
+		assert.Error(t, err, `workspace: invalid name "../escape"`)
+	})
+
+	t.Run("Sweeps orphaned workspaces", func(t *testing.T) {
+		t.Parallel()
+
+		td := tfs.NewDir(t, "enduro-test-fsutil",
+			tfs.WithDir("ws-old", tfs.WithFile("a.txt", "a")),
+			tfs.WithDir("ws-new"),
+			tfs.WithDir("other-old"),
+			tfs.WithFile("ws-file", ""),
+		)
+		old := time.Now().Add(-2 * time.Hour)
+		for _, name := range []string{"ws-old", "other-old", "ws-file"} {
+			assert.NilError(t, os.Chtimes(td.Join(name), old, old))
+		}
+
+		wm, err := fsutil.NewWorkspaceManager(fsutil.WorkspaceOptions{Root: td.Path(), Prefix: "ws-"})
+		assert.NilError(t, err)
+		dir, err := wm.Create("tracked")
+		assert.NilError(t, err)
+		assert.NilError(t, os.Chtimes(dir, old, old))
+
+		removed, err := wm.Sweep(time.Hour)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, removed, []string{td.Join("ws-old")})
+		assert.Assert(t, fsutil.FileExists(dir))
+		assert.Assert(t, fsutil.FileExists(td.Join("ws-new")))
+		assert.Assert(t, fsutil.FileExists(td.Join("other-old")))
+		assert.Assert(t, fsutil.FileExists(td.Join("ws-file")))
+	})
+}
@@ -0,0 +1,28 @@
+//go:build !(linux || darwin)
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+)
+
+// ListXattrs is not supported on this platform.
+func ListXattrs(path string) ([]string, error) {
+	return nil, &os.PathError{Op: "listxattr", Path: path, Err: errors.ErrUnsupported}
+}
+
+// GetXattr is not supported on this platform.
+func GetXattr(path, name string) ([]byte, error) {
+	return nil, &os.PathError{Op: "getxattr " + name, Path: path, Err: errors.ErrUnsupported}
+}
+
+// SetXattr is not supported on this platform.
+func SetXattr(path, name string, value []byte) error {
+	return &os.PathError{Op: "setxattr " + name, Path: path, Err: errors.ErrUnsupported}
+}
+
+// CopyXattrs is not supported on this platform.
+func CopyXattrs(src, dst string) error {
+	return &os.PathError{Op: "listxattr", Path: src, Err: errors.ErrUnsupported}
+}
@@ -0,0 +1,82 @@
+package fsutil_test
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	tfs "gotest.tools/v3/fs"
+
+	"go.artefactual.dev/tools/fsutil"
+)
+
+// setXattr sets a user extended attribute, skipping the test if the file
+// system doesn't support them.
+func setXattr(t *testing.T, path, name, value string) {
+	t.Helper()
+
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("extended attributes aren't supported on " + runtime.GOOS)
+	}
+	err := fsutil.SetXattr(path, name, []byte(value))
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("the file system doesn't support user extended attributes")
+	}
+	assert.NilError(t, err)
+}
+
+func TestXattrs(t *testing.T) {
+	t.Parallel()
+
+	td := tfs.NewDir(t, "enduro-test-fsutil",
+		tfs.WithFile("src.txt", "src"),
+		tfs.WithFile("dst.txt", "dst"),
+	)
+	setXattr(t, td.Join("src.txt"), "user.checksum", "abc")
+	setXattr(t, td.Join("src.txt"), "user.agent", "enduro")
+
+	names, err := fsutil.ListXattrs(td.Join("src.txt"))
+	assert.NilError(t, err)
+	assert.Assert(t, len(names) >= 2)
+
+	value, err := fsutil.GetXattr(td.Join("src.txt"), "user.checksum")
+	assert.NilError(t, err)
+	assert.Equal(t, string(value), "abc")
+
+	_, err = fsutil.GetXattr(td.Join("src.txt"), "user.missing")
+	assert.ErrorContains(t, err, "getxattr user.missing "+td.Join("src.txt"))
+
+	assert.NilError(t, fsutil.CopyXattrs(td.Join("src.txt"), td.Join("dst.txt")))
+	value, err = fsutil.GetXattr(td.Join("dst.txt"), "user.agent")
+	assert.NilError(t, err)
+	assert.Equal(t, string(value), "enduro")
+}
+
+func TestCopyTimes(t *testing.T) {
+	t.Parallel()
+
+	td := tfs.NewDir(t, "enduro-test-fsutil",
+		tfs.WithFile("src.txt", "src"),
+		tfs.WithFile("dst.txt", "dst"),
+	)
+	atime := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.NilError(t, os.Chtimes(td.Join("src.txt"), atime, mtime))
+
+	err := fsutil.CopyTimes(td.Join("src.txt"), td.Join("dst.txt"))
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		assert.ErrorIs(t, err, errors.ErrUnsupported)
+		return
+	}
+	assert.NilError(t, err)
+
+	fi, err := os.Stat(td.Join("dst.txt"))
+	assert.NilError(t, err)
+	assert.Assert(t, fi.ModTime().Equal(mtime))
+	got, ok := fsutil.FileAtime(fi)
+	assert.Assert(t, ok)
+	assert.Assert(t, got.Equal(atime))
+}
@@ -0,0 +1,86 @@
+//go:build linux || darwin
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ListXattrs returns the names of the extended attributes of the file at path,
+// following symbolic links.
+func ListXattrs(path string) ([]string, error) {
+	size, err := unix.Listxattr(path, nil)
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	size, err = unix.Listxattr(path, buf)
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+
+	var names []string
+	for name := range strings.SplitSeq(string(buf[:size]), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// GetXattr returns the value of the extended attribute name of the file at
+// path, following symbolic links.
+func GetXattr(path, name string) ([]byte, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, &os.PathError{Op: "getxattr " + name, Path: path, Err: err}
+	}
+	value := make([]byte, size)
+	size, err = unix.Getxattr(path, name, value)
+	if err != nil {
+		return nil, &os.PathError{Op: "getxattr " + name, Path: path, Err: err}
+	}
+	return value[:size], nil
+}
+
+// SetXattr sets the value of the extended attribute name of the file at path,
+// following symbolic links.
+func SetXattr(path, name string, value []byte) error {
+	if err := unix.Setxattr(path, name, value, 0); err != nil {
+		return &os.PathError{Op: "setxattr " + name, Path: path, Err: err}
+	}
+	return nil
+}
+
+// CopyXattrs copies the extended attributes of the file src to the file dst,
+// following symbolic links. A source on a file system without extended
+// attributes has none to copy. It returns the errors of every attribute that
+// couldn't be copied joined.
+func CopyXattrs(src, dst string) error {
+	names, err := ListXattrs(src)
+	if errors.Is(err, unix.ENOTSUP) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, name := range names {
+		value, err := GetXattr(src, name)
+		if err == nil {
+			err = SetXattr(dst, name, value)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
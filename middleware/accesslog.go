@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+)
+
+// AccessLogConfig configures the AccessLog middleware.
+type AccessLogConfig struct {
+	// Level is the verbosity level of the log entries, see logr.Logger.V.
+	Level int
+	// ExcludePaths are request paths that aren't logged, e.g. "/healthz".
+	ExcludePaths []string
+	// SampleRate is the fraction of requests logged, between 0 and 1. Server
+	// errors are always logged. Defaults to 1, logging every request.
+	SampleRate float64
+}
+
+// AccessLog logs every request served, once the response is written, with its
+// method, path, route, status, response size in bytes, duration, remote IP and
+// user agent. The request ID is also logged when RequestID is applied before
+// AccessLog.
+//
+// The route is the template of the matched gorilla/mux route, e.g.
+// "/users/{id}", when AccessLog is used as a mux middleware, or the pattern
+// of the matched http.ServeMux route.
+func AccessLog(logger logr.Logger, cfg AccessLogConfig) func(http.Handler) http.Handler {
+	if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+		cfg.SampleRate = 1
+	}
+	logger = logger.V(cfg.Level)
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(cfg.ExcludePaths, r.URL.Path) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			rw := newResponseWriter(w)
+			h.ServeHTTP(rw, r)
+
+			status := rw.Status()
+			if status == 0 && !rw.hijacked {
+				// The server replies with 200 OK to handlers writing nothing.
+				status = http.StatusOK
+			}
+			if status < 500 && cfg.SampleRate < 1 && rand.Float64() >= cfg.SampleRate {
+				return
+			}
+
+			requestLogger(logger, r).Info("HTTP request.",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"route", routeTemplate(r),
+				"status", status,
+				"bytes", rw.bytes,
+				"duration", time.Since(start),
+				"remoteIP", remoteIP(r),
+				"userAgent", r.UserAgent(),
+			)
+		})
+	}
+}
+
+// routeTemplate returns the template of the route matched by r, or an empty
+// string.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return r.Pattern
+}
+
+// remoteIP returns the IP address of the client that sent r, or of the last
+// proxy.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,163 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/gorilla/mux"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+
+	"go.artefactual.dev/tools/middleware"
+)
+
+// newTestLogger returns a logger with the given verbosity and a function
+// returning the lines logged.
+func newTestLogger(verbosity int) (logr.Logger, func() []string) {
+	var (
+		mu    sync.Mutex
+		lines []string
+	)
+	logger := funcr.New(
+		func(prefix, args string) {
+			mu.Lock()
+			defer mu.Unlock()
+			lines = append(lines, args)
+		},
+		funcr.Options{Verbosity: verbosity},
+	)
+
+	return logger, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(lines)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Logs requests with their mux route", func(t *testing.T) {
+		t.Parallel()
+
+		logger, logged := newTestLogger(0)
+		router := mux.NewRouter()
+		router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("Hi there!"))
+		})
+		router.Use(middleware.AccessLog(logger, middleware.AccessLogConfig{}))
+
+		req := httptest.NewRequest("POST", "/users/42", nil)
+		req.Header.Set("User-Agent", "enduro-test")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		lines := logged()
+		assert.Equal(t, len(lines), 1)
+		for _, s := range []string{
+			`"msg"="HTTP request."`,
+			`"method"="POST"`,
+			`"path"="/users/42"`,
+			`"route"="/users/{id}"`,
+			`"status"=201`,
+			`"bytes"=9`,
+			`"duration"=`,
+			`"remoteIP"="192.0.2.1"`,
+			`"userAgent"="enduro-test"`,
+		} {
+			assert.Assert(t, cmp.Contains(lines[0], s))
+		}
+	})
+
+	t.Run("Logs the ServeMux pattern", func(t *testing.T) {
+		t.Parallel()
+
+		logger, logged := newTestLogger(0)
+		serveMux := http.NewServeMux()
+		serveMux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {})
+		h := middleware.AccessLog(logger, middleware.AccessLogConfig{})(serveMux)
+
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items/1", nil))
+
+		lines := logged()
+		assert.Equal(t, len(lines), 1)
+		assert.Assert(t, cmp.Contains(lines[0], `"route"="GET /items/{id}"`))
+		assert.Assert(t, cmp.Contains(lines[0], `"status"=200`))
+	})
+
+	t.Run("Logs at the configured level", func(t *testing.T) {
+		t.Parallel()
+
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		cfg := middleware.AccessLogConfig{Level: 2}
+
+		logger, logged := newTestLogger(1)
+		middleware.AccessLog(logger, cfg)(h).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, len(logged()), 0)
+
+		logger, logged = newTestLogger(2)
+		middleware.AccessLog(logger, cfg)(h).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, len(logged()), 1)
+	})
+
+	t.Run("Excludes paths", func(t *testing.T) {
+		t.Parallel()
+
+		logger, logged := newTestLogger(0)
+		h := middleware.AccessLog(logger, middleware.AccessLogConfig{ExcludePaths: []string{"/healthz"}})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		)
+
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/other", nil))
+
+		lines := logged()
+		assert.Equal(t, len(lines), 1)
+		assert.Assert(t, cmp.Contains(lines[0], `"path"="/other"`))
+	})
+
+	t.Run("Samples requests but server errors", func(t *testing.T) {
+		t.Parallel()
+
+		logger, logged := newTestLogger(0)
+		h := middleware.AccessLog(logger, middleware.AccessLogConfig{SampleRate: 1e-12})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/fail" {
+					w.WriteHeader(http.StatusBadGateway)
+				}
+			}),
+		)
+
+		for range 10 {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+
+		lines := logged()
+		assert.Equal(t, len(lines), 1)
+		assert.Assert(t, cmp.Contains(lines[0], `"status"=502`))
+	})
+
+	t.Run("Keeps the response writer flushable", func(t *testing.T) {
+		t.Parallel()
+
+		logger, _ := newTestLogger(0)
+		h := middleware.AccessLog(logger, middleware.AccessLogConfig{})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("chunk"))
+				w.(http.Flusher).Flush()
+			}),
+		)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, rec.Flushed, true)
+		assert.Equal(t, strings.TrimSpace(rec.Body.String()), "chunk")
+	})
+}
@@ -0,0 +1,258 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// AuthConfig configures the Authenticate middleware.
+type AuthConfig struct {
+	// Issuer is the URL of the OIDC issuer, used to discover its JWKS.
+	Issuer string
+	// Audience is the value expected in the "aud" claim of the tokens.
+	Audience string
+	// Scopes are the scopes tokens must all be granted, in their "scope" or
+	// "scp" claim.
+	Scopes []string
+	// Claims are the claims tokens must hold with the given values, e.g.
+	// {"email_verified": true}. Values are compared after a JSON round trip,
+	// and a claim holding an array matches when it contains the value.
+	Claims map[string]any
+	// Realm is the realm sent in WWW-Authenticate headers.
+	Realm string
+	// ExcludePaths are request paths that don't require authentication, e.g.
+	// "/healthz".
+	ExcludePaths []string
+}
+
+// Validate validates the config.
+func (c AuthConfig) Validate() error {
+	var errs []error
+	if c.Issuer == "" {
+		errs = append(errs, errors.New("missing OIDC issuer"))
+	}
+	if c.Audience == "" {
+		errs = append(errs, errors.New("missing OIDC audience"))
+	}
+	for name, value := range c.Claims {
+		if _, err := json.Marshal(value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value of claim %q: %v", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Claims are the verified claims of a bearer token.
+type Claims struct {
+	Issuer   string
+	Subject  string
+	Audience []string
+	Expiry   time.Time
+	// Scopes are the scopes granted by the "scope" or "scp" claim.
+	Scopes []string
+	// Raw holds every claim of the token.
+	Raw map[string]any
+}
+
+// HasScope reports whether the token was granted scope.
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+type claimsKey struct{}
+
+// WithClaims returns a copy of ctx holding the verified claims c.
+func WithClaims(ctx context.Context, c *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, c)
+}
+
+// ClaimsFromContext returns the verified claims stored in ctx, if any.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(*Claims)
+	return c, ok
+}
+
+// Authenticate verifies the bearer JSON Web Token of every request, sent in
+// the Authorization header, against the JWKS of the OIDC issuer discovered
+// with ctx. Tokens must be signed by the issuer, unexpired, issued for the
+// audience and hold the required scopes and claims. The verified claims are
+// stored in the request context, see ClaimsFromContext.
+//
+// Following RFC 6750, requests without a valid token are rejected with 401
+// Unauthorized and those lacking scopes or claims with 403 Forbidden, with a
+// WWW-Authenticate header describing the error.
+func Authenticate(ctx context.Context, cfg AuthConfig) (func(http.Handler) http.Handler, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover OIDC provider: %w", err)
+	}
+	verifier := provider.VerifierContext(
+		// Keep the key set usable once ctx is done.
+		context.WithoutCancel(ctx),
+		&oidc.Config{ClientID: cfg.Audience},
+	)
+
+	// Normalize the required values as they would be decoded from a token.
+	claims := make(map[string]any, len(cfg.Claims))
+	for name, value := range cfg.Claims {
+		b, _ := json.Marshal(value)
+		var v any
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("invalid value of claim %q: %v", name, err)
+		}
+		claims[name] = v
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(cfg.ExcludePaths, r.URL.Path) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			raw, ok := bearerToken(r)
+			if !ok {
+				authError(w, http.StatusUnauthorized, cfg.Realm)
+				return
+			}
+
+			token, err := verifier.Verify(r.Context(), raw)
+			if err != nil {
+				desc := "The access token is invalid"
+				var expired *oidc.TokenExpiredError
+				if errors.As(err, &expired) {
+					desc = "The access token expired"
+				}
+				authError(w, http.StatusUnauthorized, cfg.Realm,
+					"error", "invalid_token", "error_description", desc)
+				return
+			}
+
+			c := &Claims{
+				Issuer:   token.Issuer,
+				Subject:  token.Subject,
+				Audience: token.Audience,
+				Expiry:   token.Expiry,
+			}
+			if err := token.Claims(&c.Raw); err != nil {
+				authError(w, http.StatusUnauthorized, cfg.Realm,
+					"error", "invalid_token", "error_description", "The access token is invalid")
+				return
+			}
+			c.Scopes = tokenScopes(c.Raw)
+
+			if !hasAll(c.Scopes, cfg.Scopes) || !hasClaims(c.Raw, claims) {
+				params := []string{"error", "insufficient_scope"}
+				if len(cfg.Scopes) > 0 {
+					params = append(params, "scope", strings.Join(cfg.Scopes, " "))
+				}
+				authError(w, http.StatusForbidden, cfg.Realm, params...)
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), c)))
+		})
+	}, nil
+}
+
+// bearerToken returns the bearer token sent in the Authorization header of r.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// tokenScopes returns the scopes of a token, from the space-separated "scope"
+// claim or the "scp" claim, which can also be an array.
+func tokenScopes(claims map[string]any) []string {
+	var scopes []string
+	for _, name := range []string{"scope", "scp"} {
+		switch v := claims[name].(type) {
+		case string:
+			scopes = append(scopes, strings.Fields(v)...)
+		case []any:
+			for _, s := range v {
+				if s, ok := s.(string); ok {
+					scopes = append(scopes, s)
+				}
+			}
+		}
+	}
+	return scopes
+}
+
+// hasAll reports whether have contains every element of want.
+func hasAll(have, want []string) bool {
+	for _, s := range want {
+		if !slices.Contains(have, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasClaims reports whether claims holds every claim in want.
+func hasClaims(claims, want map[string]any) bool {
+	for name, value := range want {
+		got, ok := claims[name]
+		if !ok {
+			return false
+		}
+		if values, ok := got.([]any); ok && !isArray(value) {
+			if !slices.ContainsFunc(values, func(v any) bool { return reflect.DeepEqual(v, value) }) {
+				return false
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func isArray(v any) bool {
+	_, ok := v.([]any)
+	return ok
+}
+
+// authError replies with status and a WWW-Authenticate header holding the
+// realm and the given name and value pairs.
+func authError(w http.ResponseWriter, status int, realm string, params ...string) {
+	var b strings.Builder
+	b.WriteString("Bearer")
+	sep := " "
+	if realm != "" {
+		b.WriteString(sep + "realm=" + quoteAuthParam(realm))
+		sep = ", "
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		b.WriteString(sep + params[i] + "=" + quoteAuthParam(params[i+1]))
+		sep = ", "
+	}
+
+	w.Header().Set("WWW-Authenticate", b.String())
+	http.Error(w, http.StatusText(status), status)
+}
+
+// quoteAuthParam returns s as a quoted string.
+func quoteAuthParam(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,175 @@
+package middleware_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/coreos/go-oidc/v3/oidc/oidctest"
+	"gotest.tools/v3/assert"
+
+	"go.artefactual.dev/tools/middleware"
+)
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+
+	issuer := &oidctest.Server{
+		PublicKeys: []oidctest.PublicKey{
+			{PublicKey: key.Public(), KeyID: "key", Algorithm: oidc.RS256},
+		},
+	}
+	srv := httptest.NewServer(issuer)
+	t.Cleanup(srv.Close)
+	issuer.SetIssuer(srv.URL)
+
+	// token returns a token signed by the issuer for the API audience with
+	// the given claims added.
+	token := func(t *testing.T, claims map[string]any) string {
+		t.Helper()
+
+		c := map[string]any{
+			"iss": srv.URL,
+			"aud": "api",
+			"sub": "user",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range claims {
+			c[k] = v
+		}
+		b, err := json.Marshal(c)
+		assert.NilError(t, err)
+
+		return oidctest.SignIDToken(key, "key", oidc.RS256, string(b))
+	}
+
+	authenticate, err := middleware.Authenticate(context.Background(), middleware.AuthConfig{
+		Issuer:       srv.URL,
+		Audience:     "api",
+		Scopes:       []string{"read", "write"},
+		Claims:       map[string]any{"groups": "admins"},
+		Realm:        "enduro",
+		ExcludePaths: []string{"/healthz"},
+	})
+	assert.NilError(t, err)
+
+	var claims *middleware.Claims
+	h := authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = middleware.ClaimsFromContext(r.Context())
+	}))
+
+	for _, tc := range []struct {
+		name          string
+		path          string
+		authorization string
+		wantStatus    int
+		wantHeader    string
+		wantSubject   string
+	}{
+		{
+			name: "Accepts a valid token",
+			authorization: "Bearer " + token(t, map[string]any{
+				"scope":  "read write delete",
+				"groups": []string{"users", "admins"},
+			}),
+			wantStatus:  http.StatusOK,
+			wantSubject: "user",
+		},
+		{
+			name: "Accepts scp array scopes",
+			authorization: "bearer " + token(t, map[string]any{
+				"scp":    []string{"read", "write"},
+				"groups": "admins",
+			}),
+			wantStatus:  http.StatusOK,
+			wantSubject: "user",
+		},
+		{
+			name:       "Skips excluded paths",
+			path:       "/healthz",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Rejects requests without a token",
+			wantStatus: http.StatusUnauthorized,
+			wantHeader: `Bearer realm="enduro"`,
+		},
+		{
+			name:          "Rejects other authentication schemes",
+			authorization: "Basic dXNlcjpwYXNz",
+			wantStatus:    http.StatusUnauthorized,
+			wantHeader:    `Bearer realm="enduro"`,
+		},
+		{
+			name:          "Rejects malformed tokens",
+			authorization: "Bearer opsie",
+			wantStatus:    http.StatusUnauthorized,
+			wantHeader:    `Bearer realm="enduro", error="invalid_token", error_description="The access token is invalid"`,
+		},
+		{
+			name:          "Rejects expired tokens",
+			authorization: "Bearer " + token(t, map[string]any{"exp": time.Now().Add(-time.Minute).Unix()}),
+			wantStatus:    http.StatusUnauthorized,
+			wantHeader:    `Bearer realm="enduro", error="invalid_token", error_description="The access token expired"`,
+		},
+		{
+			name:          "Rejects tokens for another audience",
+			authorization: "Bearer " + token(t, map[string]any{"aud": "other", "scope": "read write"}),
+			wantStatus:    http.StatusUnauthorized,
+			wantHeader:    `Bearer realm="enduro", error="invalid_token", error_description="The access token is invalid"`,
+		},
+		{
+			name:          "Rejects tokens missing a scope",
+			authorization: "Bearer " + token(t, map[string]any{"scope": "read", "groups": "admins"}),
+			wantStatus:    http.StatusForbidden,
+			wantHeader:    `Bearer realm="enduro", error="insufficient_scope", scope="read write"`,
+		},
+		{
+			name:          "Rejects tokens missing a claim",
+			authorization: "Bearer " + token(t, map[string]any{"scope": "read write", "groups": []string{"users"}}),
+			wantStatus:    http.StatusForbidden,
+			wantHeader:    `Bearer realm="enduro", error="insufficient_scope", scope="read write"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := tc.path
+			if path == "" {
+				path = "/"
+			}
+			req := httptest.NewRequest("GET", path, nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			claims = nil
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, w.Code, tc.wantStatus)
+			assert.Equal(t, w.Header().Get("WWW-Authenticate"), tc.wantHeader)
+			if tc.wantSubject == "" {
+				assert.Assert(t, claims == nil)
+				return
+			}
+			assert.Equal(t, claims.Subject, tc.wantSubject)
+			assert.Equal(t, claims.Issuer, srv.URL)
+			assert.DeepEqual(t, claims.Audience, []string{"api"})
+			assert.Assert(t, claims.HasScope("read"))
+		})
+	}
+
+	t.Run("Validates the config", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := middleware.Authenticate(context.Background(), middleware.AuthConfig{})
+		assert.Error(t, err, "missing OIDC issuer\nmissing OIDC audience")
+	})
+}
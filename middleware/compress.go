@@ -0,0 +1,357 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultCompressMinSize is the default minimum size in bytes of the responses
+// compressed by Compress.
+const DefaultCompressMinSize = 1024
+
+// Encodings supported by Compress.
+const (
+	EncodingZstd   = "zstd"
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+// CompressConfig configures the Compress middleware.
+type CompressConfig struct {
+	// MinSize is the minimum size in bytes of the responses compressed,
+	// smaller bodies aren't worth the overhead. Defaults to
+	// DefaultCompressMinSize.
+	MinSize int
+	// Encodings are the encodings used, in order of preference when the
+	// client accepts several equally. Defaults to zstd, br and gzip.
+	Encodings []string
+	// ExcludedContentTypes are additional media types that aren't
+	// compressed, e.g. "application/x-tar". Types ending in "/*" match any
+	// subtype.
+	ExcludedContentTypes []string
+}
+
+// compressedContentTypes are the media types that are already compressed.
+var compressedContentTypes = []string{
+	"image/*",
+	"video/*",
+	"audio/*",
+	"font/woff",
+	"font/woff2",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/zip",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/vnd.rar",
+	"application/pdf",
+}
+
+// compressibleImages are the image types that are worth compressing.
+var compressibleImages = []string{"image/svg+xml", "image/bmp", "image/x-icon"}
+
+// Compress compresses responses using the encoding preferred by the client
+// in its Accept-Encoding header among zstd, brotli and gzip.
+//
+// Responses are only compressed when their body reaches MinSize bytes, or is
+// flushed, and their content type isn't already compressed, e.g. images or
+// archives. Responses that already have a Content-Encoding, partial content
+// and responses to HEAD requests are left untouched. The Vary header of every
+// response includes Accept-Encoding, and strong ETags of compressed responses
+// are made weak.
+func Compress(cfg CompressConfig) func(http.Handler) http.Handler {
+	if cfg.MinSize <= 0 {
+		cfg.MinSize = DefaultCompressMinSize
+	}
+	if len(cfg.Encodings) == 0 {
+		cfg.Encodings = []string{EncodingZstd, EncodingBrotli, EncodingGzip}
+	}
+	cfg.Encodings = slices.DeleteFunc(slices.Clone(cfg.Encodings), func(e string) bool {
+		return encoderPools[e] == nil
+	})
+	excluded := append(slices.Clone(compressedContentTypes), cfg.ExcludedContentTypes...)
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Values("Accept-Encoding"), cfg.Encodings)
+			if encoding == "" || r.Method == http.MethodHead {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				minSize:        cfg.MinSize,
+				excluded:       excluded,
+			}
+			h.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+}
+
+// negotiateEncoding returns the encoding among supported with the highest
+// quality value in the Accept-Encoding header values, or an empty string if
+// none is acceptable. Ties are broken by the order of supported.
+func negotiateEncoding(accept []string, supported []string) string {
+	quality := map[string]float64{}
+	wildcard := -1.0
+	for _, v := range accept {
+		for part := range strings.SplitSeq(v, ",") {
+			coding, params, _ := strings.Cut(part, ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding == "" {
+				continue
+			}
+			q := 1.0
+			for p := range strings.SplitSeq(params, ";") {
+				name, value, _ := strings.Cut(p, "=")
+				if strings.TrimSpace(name) != "q" {
+					continue
+				}
+				if f, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = f
+				}
+			}
+			if coding == "*" {
+				wildcard = q
+			} else {
+				quality[coding] = q
+			}
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, e := range supported {
+		q, ok := quality[e]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+
+	return best
+}
+
+// encoder is a compressing writer that can be reused.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// encoderPools holds pools of encoders for each supported encoding.
+var encoderPools = map[string]*sync.Pool{
+	EncodingZstd: {New: func() any {
+		// RFC 9659 limits the window size to 8 MiB for HTTP.
+		e, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(8<<20))
+		return e
+	}},
+	EncodingBrotli: {New: func() any {
+		return brotli.NewWriterLevel(nil, 5)
+	}},
+	EncodingGzip: {New: func() any {
+		return gzip.NewWriter(nil)
+	}},
+}
+
+// compressWriter compresses the response of a handler once it knows whether
+// it's worth it, buffering up to minSize bytes until then.
+type compressWriter struct {
+	http.ResponseWriter
+
+	encoding string
+	minSize  int
+	excluded []string
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status != 0 {
+		// Superfluous call, the header is written once decided.
+		return
+	}
+	if code >= 100 && code <= 199 {
+		// Informational responses can be followed by another header.
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+	if !bodyAllowed(code) {
+		_ = w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		if len(w.buf)+len(b) < w.minSize {
+			w.buf = append(w.buf, b...)
+			return len(b), nil
+		}
+		w.buf = append(w.buf, b...)
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher, compressing the response if possible
+// regardless of its size as it's streamed.
+func (w *compressWriter) Flush() {
+	_ = w.FlushError()
+}
+
+// FlushError flushes the buffered data to the client, see
+// http.ResponseController.
+func (w *compressWriter) FlushError() error {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		if err := w.decide(true); err != nil {
+			return err
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack implements http.Hijacker, the response is then left untouched.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.decided = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter for http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide writes the response header, compressing the response if compress is
+// set and its headers allow it, and the buffered body.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if compress && w.compressible(h) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.enc = encoderPools[w.encoding].Get().(encoder)
+		w.enc.Reset(w.ResponseWriter)
+	}
+
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+
+	return err
+}
+
+// compressible reports whether the response with header h can be compressed.
+func (w *compressWriter) compressible(h http.Header) bool {
+	if !bodyAllowed(w.status) || w.status == http.StatusPartialContent {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return true
+	}
+	if slices.Contains(compressibleImages, mediaType) {
+		return true
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	for _, t := range w.excluded {
+		if t == mediaType || t == major+"/*" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// close writes the buffered response and closes the encoder once the handler
+// has returned.
+func (w *compressWriter) close() {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			// Let the server write its default response.
+			return
+		}
+		_ = w.decide(false)
+	}
+	if w.enc != nil {
+		_ = w.enc.Close()
+		w.enc.Reset(nil)
+		encoderPools[w.encoding].Put(w.enc)
+		w.enc = nil
+	}
+}
+
+// bodyAllowed reports whether a response with status can have a body.
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified && (status < 100 || status > 199)
+}
@@ -0,0 +1,264 @@
+package middleware_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"gotest.tools/v3/assert"
+
+	"go.artefactual.dev/tools/middleware"
+)
+
+// decode returns the body of w decoded according to its Content-Encoding.
+func decode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var r io.Reader = w.Body
+	switch w.Header().Get("Content-Encoding") {
+	case "gzip":
+		zr, err := gzip.NewReader(w.Body)
+		assert.NilError(t, err)
+		r = zr
+	case "zstd":
+		zr, err := zstd.NewReader(w.Body)
+		assert.NilError(t, err)
+		defer zr.Close()
+		r = zr
+	case "br":
+		r = brotli.NewReader(w.Body)
+	}
+
+	b, err := io.ReadAll(r)
+	assert.NilError(t, err)
+
+	return string(b)
+}
+
+func TestCompress(t *testing.T) {
+	t.Parallel()
+
+	listing := `{"items":[` + strings.Repeat(`{"name":"transfer","status":"done"},`, 100) + `{}]}`
+	jsonHandler := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "123")
+			w.Header().Set("ETag", `"v1"`)
+			io.WriteString(w, body)
+		}
+	}
+
+	type test struct {
+		name           string
+		cfg            middleware.CompressConfig
+		method         string
+		acceptEncoding string
+		handler        http.Handler
+		want           string
+		wantEncoding   string
+	}
+	for _, tc := range []test{
+		{
+			name:           "Compresses with gzip",
+			acceptEncoding: "gzip, deflate",
+			handler:        jsonHandler(listing),
+			want:           listing,
+			wantEncoding:   "gzip",
+		},
+		{
+			name:           "Compresses with zstd",
+			acceptEncoding: "gzip, zstd",
+			handler:        jsonHandler(listing),
+			want:           listing,
+			wantEncoding:   "zstd",
+		},
+		{
+			name:           "Compresses with brotli",
+			acceptEncoding: "gzip;q=0.5, br;q=0.9, zstd;q=0.1",
+			handler:        jsonHandler(listing),
+			want:           listing,
+			wantEncoding:   "br",
+		},
+		{
+			name:           "Follows the configured preference",
+			cfg:            middleware.CompressConfig{Encodings: []string{"gzip", "zstd"}},
+			acceptEncoding: "*",
+			handler:        jsonHandler(listing),
+			want:           listing,
+			wantEncoding:   "gzip",
+		},
+		{
+			name:           "Doesn't compress rejected encodings",
+			acceptEncoding: "*;q=0, gzip;q=0",
+			handler:        jsonHandler(listing),
+			want:           listing,
+		},
+		{
+			name:    "Doesn't compress without Accept-Encoding",
+			handler: jsonHandler(listing),
+			want:    listing,
+		},
+		{
+			name:           "Doesn't compress small bodies",
+			acceptEncoding: "gzip",
+			handler:        jsonHandler(`{"items":[]}`),
+			want:           `{"items":[]}`,
+		},
+		{
+			name:           "Doesn't compress HEAD requests",
+			method:         "HEAD",
+			acceptEncoding: "gzip",
+			handler:        jsonHandler(listing),
+			// The recorder keeps the body the server would discard.
+			want: listing,
+		},
+		{
+			name:           "Doesn't compress compressed content types",
+			acceptEncoding: "gzip",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/zip")
+				io.WriteString(w, listing)
+			}),
+			want: listing,
+		},
+		{
+			name:           "Doesn't compress excluded content types",
+			cfg:            middleware.CompressConfig{ExcludedContentTypes: []string{"text/*"}},
+			acceptEncoding: "gzip",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, strings.Repeat("plain text ", 200))
+			}),
+			want: strings.Repeat("plain text ", 200),
+		},
+		{
+			name:           "Doesn't compress encoded responses",
+			acceptEncoding: "gzip",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "identity")
+				io.WriteString(w, listing)
+			}),
+			want:         listing,
+			wantEncoding: "identity",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			method := tc.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			middleware.Compress(tc.cfg)(tc.handler).ServeHTTP(w, req)
+
+			assert.Equal(t, w.Code, http.StatusOK)
+			assert.Equal(t, w.Header().Get("Vary"), "Accept-Encoding")
+			assert.Equal(t, w.Header().Get("Content-Encoding"), tc.wantEncoding)
+			assert.Equal(t, decode(t, w), tc.want)
+			if tc.wantEncoding != "" && tc.wantEncoding != "identity" {
+				assert.Equal(t, w.Header().Get("Content-Length"), "")
+				assert.Equal(t, w.Header().Get("ETag"), `W/"v1"`)
+			}
+		})
+	}
+
+	t.Run("Keeps the status code", func(t *testing.T) {
+		t.Parallel()
+
+		h := middleware.Compress(middleware.CompressConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, listing)
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		assert.Equal(t, w.Code, http.StatusNotFound)
+		assert.Equal(t, w.Header().Get("Content-Type"), "text/plain; charset=utf-8")
+		assert.Equal(t, decode(t, w), listing)
+	})
+
+	t.Run("Writes no body responses", func(t *testing.T) {
+		t.Parallel()
+
+		h := middleware.Compress(middleware.CompressConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		assert.Equal(t, w.Code, http.StatusNoContent)
+		assert.Equal(t, w.Header().Get("Content-Encoding"), "")
+		assert.Equal(t, w.Body.Len(), 0)
+	})
+
+	t.Run("Streams flushed responses", func(t *testing.T) {
+		t.Parallel()
+
+		flushed := make(chan struct{})
+		proceed := make(chan struct{})
+		h := middleware.Compress(middleware.CompressConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: first\n\n")
+			assert.NilError(t, http.NewResponseController(w).Flush())
+			close(flushed)
+			<-proceed
+			io.WriteString(w, "data: second\n\n")
+		}))
+		ts := httptest.NewServer(h)
+		defer ts.Close()
+
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		assert.NilError(t, err)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := ts.Client().Do(req)
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, resp.Header.Get("Content-Encoding"), "gzip")
+
+		<-flushed
+		zr, err := gzip.NewReader(resp.Body)
+		assert.NilError(t, err)
+		first := make([]byte, len("data: first\n\n"))
+		_, err = io.ReadFull(zr, first)
+		assert.NilError(t, err)
+		assert.Equal(t, string(first), "data: first\n\n")
+
+		close(proceed)
+		rest, err := io.ReadAll(zr)
+		assert.NilError(t, err)
+		assert.Equal(t, string(rest), "data: second\n\n")
+	})
+}
+
+func TestCompressEncoderReuse(t *testing.T) {
+	t.Parallel()
+
+	body := bytes.Repeat([]byte("reused encoder "), 200)
+	h := middleware.Compress(middleware.CompressConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+
+	for _, encoding := range []string{"zstd", "br", "gzip", "zstd", "br", "gzip"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		assert.Equal(t, w.Header().Get("Content-Encoding"), encoding)
+		assert.Equal(t, decode(t, w), string(body))
+	}
+}
@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig configures the CORS middleware.
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed to make cross-origin requests,
+	// e.g. "https://dashboard.example.com". An origin can hold one wildcard,
+	// e.g. "https://*.example.com", and "*" allows any origin without
+	// credentials. Origins are matched case-insensitively.
+	AllowedOrigins []string
+	// AllowedOriginPatterns are regular expressions matching additional
+	// allowed origins, e.g. `^https://pr-\d+\.example\.com$`.
+	AllowedOriginPatterns []*regexp.Regexp
+	// AllowedMethods are the methods allowed in cross-origin requests.
+	// Defaults to GET, HEAD and POST.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in cross-origin
+	// requests, "*" allows any header.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers that browsers expose to
+	// cross-origin requests.
+	ExposedHeaders []string
+	// AllowCredentials allows cross-origin requests to include credentials,
+	// e.g. cookies. The request origin is then sent back instead of "*". It's
+	// ignored when AllowedOrigins holds "*", which would otherwise let every
+	// origin make requests with the user's credentials.
+	AllowCredentials bool
+	// MaxAge is how long the result of a preflight request can be cached.
+	// Zero leaves the browser default.
+	MaxAge time.Duration
+}
+
+// CORS implements Cross-Origin Resource Sharing for the allowed origins.
+//
+// Preflight requests, i.e. OPTIONS requests with an Origin and an
+// Access-Control-Request-Method header, are answered with 204 No Content
+// without calling the next handler. The Access-Control-Allow-* headers are
+// only set when the origin, method and headers requested are all allowed.
+// Other requests from allowed origins get the Access-Control-Allow-Origin and
+// Access-Control-Expose-Headers headers and are passed to the next handler.
+// The Vary header is set so caches don't mix responses for different origins.
+//
+// Applied per route, e.g. to a gorilla/mux subrouter, CORS lets every API
+// have its own policy; the routes must then also match OPTIONS requests.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	p := newCORSPolicy(cfg)
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if r.Method == http.MethodOptions && origin != "" && r.Header.Get("Access-Control-Request-Method") != "" {
+				p.preflight(w, r, origin)
+				return
+			}
+
+			if p.varyOrigin() {
+				w.Header().Add("Vary", "Origin")
+			}
+			if origin != "" && p.allowedOrigin(origin) {
+				p.setOrigin(w.Header(), origin)
+				if len(p.exposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", p.exposedHeaders)
+				}
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// corsPolicy is the normalized form of a CORSConfig.
+type corsPolicy struct {
+	anyOrigin      bool
+	origins        []string
+	wildcards      [][2]string
+	patterns       []*regexp.Regexp
+	methods        []string
+	anyHeader      bool
+	headers        []string
+	exposedHeaders string
+	credentials    bool
+	maxAge         string
+}
+
+func newCORSPolicy(cfg CORSConfig) *corsPolicy {
+	p := &corsPolicy{
+		patterns:       cfg.AllowedOriginPatterns,
+		methods:        cfg.AllowedMethods,
+		exposedHeaders: strings.Join(cfg.ExposedHeaders, ", "),
+	}
+
+	for _, o := range cfg.AllowedOrigins {
+		o = strings.ToLower(o)
+		if o == "*" {
+			p.anyOrigin = true
+		} else if prefix, suffix, ok := strings.Cut(o, "*"); ok {
+			p.wildcards = append(p.wildcards, [2]string{prefix, suffix})
+		} else {
+			p.origins = append(p.origins, o)
+		}
+	}
+	p.credentials = cfg.AllowCredentials && !p.anyOrigin
+	if len(p.methods) == 0 {
+		p.methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	for _, h := range cfg.AllowedHeaders {
+		if h == "*" {
+			p.anyHeader = true
+		} else {
+			p.headers = append(p.headers, http.CanonicalHeaderKey(h))
+		}
+	}
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+
+	return p
+}
+
+// varyOrigin reports whether responses depend on the request origin.
+func (p *corsPolicy) varyOrigin() bool {
+	return !p.anyOrigin
+}
+
+func (p *corsPolicy) allowedOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	o := strings.ToLower(origin)
+	if slices.Contains(p.origins, o) {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if len(o) > len(w[0])+len(w[1]) && strings.HasPrefix(o, w[0]) && strings.HasSuffix(o, w[1]) {
+			return true
+		}
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowedHeaders reports whether every header listed in the
+// Access-Control-Request-Headers value requested is allowed.
+func (p *corsPolicy) allowedHeaders(requested string) bool {
+	if p.anyHeader {
+		return true
+	}
+	for h := range strings.SplitSeq(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h != "" && !slices.Contains(p.headers, http.CanonicalHeaderKey(h)) {
+			return false
+		}
+	}
+	return true
+}
+
+// setOrigin sets the Access-Control-Allow-Origin header, and the
+// Access-Control-Allow-Credentials header when credentials are allowed.
+func (p *corsPolicy) setOrigin(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (p *corsPolicy) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	method := r.Header.Get("Access-Control-Request-Method")
+	requested := strings.Join(r.Header.Values("Access-Control-Request-Headers"), ",")
+	if p.allowedOrigin(origin) && slices.Contains(p.methods, method) && p.allowedHeaders(requested) {
+		p.setOrigin(h, origin)
+		h.Set("Access-Control-Allow-Methods", strings.Join(p.methods, ", "))
+		if p.anyHeader && requested != "" {
+			// The "*" value isn't supported with credentials, list the
+			// requested headers instead.
+			h.Set("Access-Control-Allow-Headers", requested)
+		} else if len(p.headers) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(p.headers, ", "))
+		}
+		if p.maxAge != "" {
+			h.Set("Access-Control-Max-Age", p.maxAge)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
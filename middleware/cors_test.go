@@ -0,0 +1,210 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"go.artefactual.dev/tools/middleware"
+)
+
+func TestCORS(t *testing.T) {
+	t.Parallel()
+
+	type test struct {
+		name        string
+		cfg         middleware.CORSConfig
+		method      string
+		header      http.Header
+		wantStatus  int
+		wantHeader  http.Header
+		wantHandled bool
+	}
+
+	apiConfig := middleware.CORSConfig{
+		AllowedOrigins:        []string{"https://dashboard.example.com", "https://*.artefactual.dev"},
+		AllowedOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`^https://pr-\d+\.example\.org$`)},
+		AllowedMethods:        []string{"GET", "PUT"},
+		AllowedHeaders:        []string{"Authorization", "content-type"},
+		ExposedHeaders:        []string{"X-Request-Id"},
+		AllowCredentials:      true,
+		MaxAge:                10 * time.Minute,
+	}
+	preflightVary := []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}
+
+	for _, tc := range []test{
+		{
+			name:        "Passes requests without origin",
+			cfg:         apiConfig,
+			method:      "GET",
+			wantStatus:  http.StatusOK,
+			wantHeader:  http.Header{"Vary": {"Origin"}},
+			wantHandled: true,
+		},
+		{
+			name:       "Allows an exact origin",
+			cfg:        apiConfig,
+			method:     "GET",
+			header:     http.Header{"Origin": {"https://Dashboard.example.com"}},
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"Vary":                             {"Origin"},
+				"Access-Control-Allow-Origin":      {"https://Dashboard.example.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Expose-Headers":    {"X-Request-Id"},
+			},
+			wantHandled: true,
+		},
+		{
+			name:       "Allows a wildcard origin",
+			cfg:        apiConfig,
+			method:     "GET",
+			header:     http.Header{"Origin": {"https://enduro.artefactual.dev"}},
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"Vary":                             {"Origin"},
+				"Access-Control-Allow-Origin":      {"https://enduro.artefactual.dev"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Expose-Headers":    {"X-Request-Id"},
+			},
+			wantHandled: true,
+		},
+		{
+			name:        "Ignores a disallowed origin",
+			cfg:         apiConfig,
+			method:      "GET",
+			header:      http.Header{"Origin": {"https://evil.example.com"}},
+			wantStatus:  http.StatusOK,
+			wantHeader:  http.Header{"Vary": {"Origin"}},
+			wantHandled: true,
+		},
+		{
+			name:        "Requires a wildcard to match at least one character",
+			cfg:         apiConfig,
+			method:      "GET",
+			header:      http.Header{"Origin": {"https://.artefactual.dev"}},
+			wantStatus:  http.StatusOK,
+			wantHeader:  http.Header{"Vary": {"Origin"}},
+			wantHandled: true,
+		},
+		{
+			name:   "Answers an allowed preflight request",
+			cfg:    apiConfig,
+			method: "OPTIONS",
+			header: http.Header{
+				"Origin":                         {"https://pr-42.example.org"},
+				"Access-Control-Request-Method":  {"PUT"},
+				"Access-Control-Request-Headers": {"authorization,content-type"},
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeader: http.Header{
+				"Vary":                             preflightVary,
+				"Access-Control-Allow-Origin":      {"https://pr-42.example.org"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Allow-Methods":     {"GET, PUT"},
+				"Access-Control-Allow-Headers":     {"Authorization, Content-Type"},
+				"Access-Control-Max-Age":           {"600"},
+			},
+		},
+		{
+			name:   "Rejects a preflight request for a disallowed method",
+			cfg:    apiConfig,
+			method: "OPTIONS",
+			header: http.Header{
+				"Origin":                        {"https://dashboard.example.com"},
+				"Access-Control-Request-Method": {"DELETE"},
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeader: http.Header{"Vary": preflightVary},
+		},
+		{
+			name:   "Rejects a preflight request for a disallowed header",
+			cfg:    apiConfig,
+			method: "OPTIONS",
+			header: http.Header{
+				"Origin":                         {"https://dashboard.example.com"},
+				"Access-Control-Request-Method":  {"GET"},
+				"Access-Control-Request-Headers": {"x-custom"},
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeader: http.Header{"Vary": preflightVary},
+		},
+		{
+			name:        "Passes OPTIONS requests that aren't preflight requests",
+			cfg:         apiConfig,
+			method:      "OPTIONS",
+			header:      http.Header{"Origin": {"https://dashboard.example.com"}},
+			wantStatus:  http.StatusOK,
+			wantHandled: true,
+			wantHeader: http.Header{
+				"Vary":                             {"Origin"},
+				"Access-Control-Allow-Origin":      {"https://dashboard.example.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Expose-Headers":    {"X-Request-Id"},
+			},
+		},
+		{
+			name:        "Allows any origin",
+			cfg:         middleware.CORSConfig{AllowedOrigins: []string{"*"}},
+			method:      "POST",
+			header:      http.Header{"Origin": {"https://example.com"}},
+			wantStatus:  http.StatusOK,
+			wantHeader:  http.Header{"Access-Control-Allow-Origin": {"*"}},
+			wantHandled: true,
+		},
+		{
+			name:        "Ignores credentials when any origin is allowed",
+			cfg:         middleware.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			method:      "POST",
+			header:      http.Header{"Origin": {"https://evil.example.com"}},
+			wantStatus:  http.StatusOK,
+			wantHeader:  http.Header{"Access-Control-Allow-Origin": {"*"}},
+			wantHandled: true,
+		},
+		{
+			name:   "Reflects requested headers when any header is allowed",
+			cfg:    middleware.CORSConfig{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}},
+			method: "OPTIONS",
+			header: http.Header{
+				"Origin":                         {"https://example.com"},
+				"Access-Control-Request-Method":  {"HEAD"},
+				"Access-Control-Request-Headers": {"x-custom"},
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeader: http.Header{
+				"Vary":                         preflightVary,
+				"Access-Control-Allow-Origin":  {"*"},
+				"Access-Control-Allow-Methods": {"GET, HEAD, POST"},
+				"Access-Control-Allow-Headers": {"x-custom"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			handled := false
+			h := middleware.CORS(tc.cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = true
+			}))
+
+			req := httptest.NewRequest(tc.method, "/", nil)
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, w.Code, tc.wantStatus)
+			assert.Equal(t, handled, tc.wantHandled)
+			want := tc.wantHeader
+			if want == nil {
+				want = http.Header{}
+			}
+			assert.DeepEqual(t, w.Header(), want)
+		})
+	}
+}
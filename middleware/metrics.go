@@ -0,0 +1,286 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets are the default upper bounds, in seconds, of the
+// request duration histogram buckets.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the default upper bounds, in bytes, of the response
+// size histogram buckets.
+var DefaultSizeBuckets = []float64{100, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8}
+
+// MetricsConfig configures Metrics.
+type MetricsConfig struct {
+	// Namespace prefixes the metric names, e.g. "enduro" reports
+	// "enduro_http_requests_total".
+	Namespace string
+	// DurationBuckets are the upper bounds of the request duration histogram
+	// buckets in seconds. Defaults to DefaultDurationBuckets.
+	DurationBuckets []float64
+	// SizeBuckets are the upper bounds of the response size histogram
+	// buckets in bytes. Defaults to DefaultSizeBuckets.
+	SizeBuckets []float64
+}
+
+// Metrics collects HTTP server metrics and exposes them in the Prometheus
+// text exposition format:
+//
+//   - http_requests_total, a counter of the requests served;
+//   - http_request_duration_seconds, a histogram of the request durations;
+//   - http_response_size_bytes, a histogram of the response sizes;
+//   - http_requests_in_flight, a gauge of the requests being served.
+//
+// Requests are labelled by method, route template and status class, e.g.
+// "2xx", and the requests in flight by method. Like with AccessLog, the route
+// is the template of the matched gorilla/mux route or the pattern of the
+// matched http.ServeMux route.
+//
+//	metrics := middleware.NewMetrics(middleware.MetricsConfig{})
+//	router.Use(metrics.Middleware)
+//	router.Handle("/metrics", metrics.Handler())
+type Metrics struct {
+	names           metricNames
+	durationBuckets []float64
+	sizeBuckets     []float64
+
+	mu       sync.Mutex
+	requests map[requestLabels]*requestSeries
+	inFlight map[string]int64
+}
+
+// metricNames holds the fully qualified metric names.
+type metricNames struct {
+	requests, duration, size, inFlight string
+}
+
+// requestLabels identifies a request series.
+type requestLabels struct {
+	method, route, status string
+}
+
+// requestSeries holds the metrics of a request series.
+type requestSeries struct {
+	count    uint64
+	duration histogram
+	size     histogram
+}
+
+// histogram counts observations in buckets with the given upper bounds.
+type histogram struct {
+	counts []uint64
+	sum    float64
+}
+
+func (h *histogram) observe(bounds []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(bounds))
+	}
+	if i, _ := slices.BinarySearch(bounds, v); i < len(bounds) {
+		h.counts[i]++
+	}
+	h.sum += v
+}
+
+// NewMetrics returns a new Metrics.
+func NewMetrics(cfg MetricsConfig) *Metrics {
+	prefix := ""
+	if cfg.Namespace != "" {
+		prefix = cfg.Namespace + "_"
+	}
+
+	return &Metrics{
+		names: metricNames{
+			requests: prefix + "http_requests_total",
+			duration: prefix + "http_request_duration_seconds",
+			size:     prefix + "http_response_size_bytes",
+			inFlight: prefix + "http_requests_in_flight",
+		},
+		durationBuckets: sortedBuckets(cfg.DurationBuckets, DefaultDurationBuckets),
+		sizeBuckets:     sortedBuckets(cfg.SizeBuckets, DefaultSizeBuckets),
+		requests:        map[requestLabels]*requestSeries{},
+		inFlight:        map[string]int64{},
+	}
+}
+
+// sortedBuckets returns a sorted copy of buckets, or of def if buckets is
+// empty.
+func sortedBuckets(buckets, def []float64) []float64 {
+	if len(buckets) == 0 {
+		buckets = def
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	return slices.Compact(buckets)
+}
+
+// Middleware records the metrics of the requests served by h.
+func (m *Metrics) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := methodLabel(r.Method)
+		m.addInFlight(method, 1)
+		defer m.addInFlight(method, -1)
+
+		start := time.Now()
+		rw := newResponseWriter(w)
+		h.ServeHTTP(rw, r)
+
+		status := rw.Status()
+		if status == 0 && !rw.hijacked {
+			// The server replies with 200 OK to handlers writing nothing.
+			status = http.StatusOK
+		}
+
+		m.observe(
+			requestLabels{method: method, route: routeTemplate(r), status: statusClass(status)},
+			time.Since(start),
+			rw.bytes,
+		)
+	})
+}
+
+func (m *Metrics) addInFlight(method string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inFlight[method] += n
+}
+
+func (m *Metrics) observe(labels requestLabels, d time.Duration, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.requests[labels]
+	if !ok {
+		s = &requestSeries{}
+		m.requests[labels] = s
+	}
+	s.count++
+	s.duration.observe(m.durationBuckets, d.Seconds())
+	s.size.observe(m.sizeBuckets, float64(size))
+}
+
+// methodLabel returns the method label of a request, replacing non-standard
+// methods with "other" to bound the number of series.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodConnect,
+		http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// statusClass returns the class of a status code, e.g. "2xx", or "unknown"
+// when no status was written, e.g. for hijacked connections.
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// Handler returns an http.Handler that writes the collected metrics in the
+// Prometheus text exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = m.write(w)
+	})
+}
+
+// write writes the collected metrics to w, with series sorted by their labels.
+func (m *Metrics) write(w io.Writer) error {
+	m.mu.Lock()
+	labels := make([]requestLabels, 0, len(m.requests))
+	series := make(map[requestLabels]requestSeries, len(m.requests))
+	for l, s := range m.requests {
+		labels = append(labels, l)
+		series[l] = requestSeries{
+			count:    s.count,
+			duration: histogram{counts: slices.Clone(s.duration.counts), sum: s.duration.sum},
+			size:     histogram{counts: slices.Clone(s.size.counts), sum: s.size.sum},
+		}
+	}
+	methods := make([]string, 0, len(m.inFlight))
+	inFlight := make(map[string]int64, len(m.inFlight))
+	for method, n := range m.inFlight {
+		methods = append(methods, method)
+		inFlight[method] = n
+	}
+	m.mu.Unlock()
+
+	slices.SortFunc(labels, func(a, b requestLabels) int {
+		return strings.Compare(a.method+"\x00"+a.route+"\x00"+a.status, b.method+"\x00"+b.route+"\x00"+b.status)
+	})
+	slices.Sort(methods)
+
+	bw := bufio.NewWriter(w)
+
+	writeHeader(bw, m.names.requests, "counter", "Total number of HTTP requests served.")
+	for _, l := range labels {
+		fmt.Fprintf(bw, "%s{%s} %d\n", m.names.requests, l.format(), series[l].count)
+	}
+
+	writeHeader(bw, m.names.duration, "histogram", "Duration of HTTP requests in seconds.")
+	for _, l := range labels {
+		s := series[l]
+		writeHistogram(bw, m.names.duration, l.format(), m.durationBuckets, s.duration, s.count)
+	}
+
+	writeHeader(bw, m.names.size, "histogram", "Size of HTTP responses in bytes.")
+	for _, l := range labels {
+		s := series[l]
+		writeHistogram(bw, m.names.size, l.format(), m.sizeBuckets, s.size, s.count)
+	}
+
+	writeHeader(bw, m.names.inFlight, "gauge", "Number of HTTP requests being served.")
+	for _, method := range methods {
+		fmt.Fprintf(bw, "%s{method=%s} %d\n", m.names.inFlight, quoteLabel(method), inFlight[method])
+	}
+
+	return bw.Flush()
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeHistogram(w io.Writer, name, labels string, bounds []float64, h histogram, count uint64) {
+	var cumulative uint64
+	for i, bound := range bounds {
+		if h.counts != nil {
+			cumulative += h.counts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, count)
+}
+
+// format returns the labels in the exposition format, without braces.
+func (l requestLabels) format() string {
+	return "method=" + quoteLabel(l.method) + ",route=" + quoteLabel(l.route) + ",status=" + quoteLabel(l.status)
+}
+
+// quoteLabel quotes a label value, escaping backslashes, double quotes and
+// line feeds as required by the exposition format.
+func quoteLabel(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
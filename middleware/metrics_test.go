@@ -0,0 +1,103 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+
+	"go.artefactual.dev/tools/middleware"
+)
+
+// scrape returns the metrics exposed by m.
+func scrape(t *testing.T, m *middleware.Metrics) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, w.Header().Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8")
+
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Records requests by method, route and status class", func(t *testing.T) {
+		t.Parallel()
+
+		metrics := middleware.NewMetrics(middleware.MetricsConfig{
+			DurationBuckets: []float64{1, 0.5},
+			SizeBuckets:     []float64{10, 100},
+		})
+		router := mux.NewRouter()
+		router.Use(metrics.Middleware)
+		router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			if mux.Vars(r)["id"] == "0" {
+				http.NotFound(w, r)
+				return
+			}
+			io.WriteString(w, "user")
+		})
+
+		for _, path := range []string{"/users/1", "/users/2", "/users/0"} {
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		}
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/users/1", nil))
+
+		got := scrape(t, metrics)
+		for _, want := range []string{
+			"# HELP http_requests_total Total number of HTTP requests served.\n# TYPE http_requests_total counter\n",
+			`http_requests_total{method="GET",route="/users/{id}",status="2xx"} 2` + "\n",
+			`http_requests_total{method="GET",route="/users/{id}",status="4xx"} 1` + "\n",
+			`http_requests_total{method="other",route="/users/{id}",status="2xx"} 1` + "\n",
+			"# TYPE http_request_duration_seconds histogram\n",
+			`http_request_duration_seconds_bucket{method="GET",route="/users/{id}",status="2xx",le="0.5"} 2` + "\n",
+			`http_request_duration_seconds_bucket{method="GET",route="/users/{id}",status="2xx",le="+Inf"} 2` + "\n",
+			`http_request_duration_seconds_count{method="GET",route="/users/{id}",status="2xx"} 2` + "\n",
+			"# TYPE http_response_size_bytes histogram\n",
+			`http_response_size_bytes_bucket{method="GET",route="/users/{id}",status="2xx",le="10"} 2` + "\n",
+			`http_response_size_bytes_sum{method="GET",route="/users/{id}",status="2xx"} 8` + "\n",
+			`http_response_size_bytes_bucket{method="GET",route="/users/{id}",status="4xx",le="10"} 0` + "\n",
+			`http_response_size_bytes_bucket{method="GET",route="/users/{id}",status="4xx",le="100"} 1` + "\n",
+			"# TYPE http_requests_in_flight gauge\n",
+			`http_requests_in_flight{method="GET"} 0` + "\n",
+		} {
+			assert.Assert(t, cmp.Contains(got, want))
+		}
+	})
+
+	t.Run("Counts requests in flight", func(t *testing.T) {
+		t.Parallel()
+
+		metrics := middleware.NewMetrics(middleware.MetricsConfig{Namespace: "enduro"})
+		var inFlight string
+		h := metrics.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inFlight = scrape(t, metrics)
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+
+		assert.Assert(t, cmp.Contains(inFlight, `enduro_http_requests_in_flight{method="POST"} 1`+"\n"))
+		assert.Assert(t, !strings.Contains(inFlight, "enduro_http_requests_total{"))
+		assert.Assert(t, cmp.Contains(scrape(t, metrics), `enduro_http_requests_total{method="POST",route="",status="2xx"} 1`+"\n"))
+	})
+
+	t.Run("Uses the http.ServeMux pattern as route", func(t *testing.T) {
+		t.Parallel()
+
+		metrics := middleware.NewMetrics(middleware.MetricsConfig{})
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+		metrics.Middleware(mux).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items/1", nil))
+
+		assert.Assert(t, cmp.Contains(scrape(t, metrics), `http_requests_total{method="GET",route="GET /items/{id}",status="2xx"} 1`+"\n"))
+	})
+}
@@ -0,0 +1,257 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultMemoryStoreSweepInterval is the default minimum time between sweeps
+// of the full buckets of a MemoryStore.
+const defaultMemoryStoreSweepInterval = time.Minute
+
+// defaultMemoryStoreMaxKeys is the maximum number of buckets of the
+// MemoryStore used by default by RateLimit.
+const defaultMemoryStoreMaxKeys = 100_000
+
+// RateLimitConfig configures the RateLimit middleware.
+type RateLimitConfig struct {
+	// Limit is the number of requests a client can make in a burst, refilled
+	// over Period.
+	Limit int
+	// Period is the time it takes to refill Limit requests.
+	Period time.Duration
+	// Key returns the key identifying the client of a request, requests with
+	// an empty key aren't limited. Defaults to KeyByIP.
+	Key func(*http.Request) string
+	// Store stores the buckets of the clients. Defaults to a MemoryStore
+	// holding up to 100000 buckets.
+	Store RateLimitStore
+}
+
+// RateLimitStore stores token buckets, e.g. in memory or in a store shared
+// by several servers.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of key, which holds up to limit
+	// tokens and is refilled at a rate of limit tokens per period.
+	Take(ctx context.Context, key string, limit int, period time.Duration) (RateLimitResult, error)
+}
+
+// RateLimitResult is the result of taking a token from a bucket.
+type RateLimitResult struct {
+	// Allowed reports whether a token was taken.
+	Allowed bool
+	// Limit is the capacity of the bucket.
+	Limit int
+	// Remaining is the number of tokens left in the bucket.
+	Remaining int
+	// Reset is the time until the bucket is full.
+	Reset time.Duration
+	// RetryAfter is the time until a token is available when none was taken.
+	RetryAfter time.Duration
+}
+
+// RateLimit limits the rate of the requests of every client using a token
+// bucket: clients can make Limit requests in a burst, and one more request
+// every Period/Limit. Clients are identified by IP address by default, see
+// KeyByIP and KeyBySubject.
+//
+// Responses carry the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// headers. Requests over the limit are rejected with 429 Too Many Requests and
+// a Retry-After header. Requests are allowed when the store fails, so its
+// unavailability doesn't take the service down.
+func RateLimit(cfg RateLimitConfig) func(http.Handler) http.Handler {
+	if cfg.Limit <= 0 {
+		cfg.Limit = 1
+	}
+	if cfg.Period <= 0 {
+		cfg.Period = time.Second
+	}
+	if cfg.Key == nil {
+		cfg.Key = KeyByIP
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore(MemoryStoreOptions{MaxKeys: defaultMemoryStoreMaxKeys})
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := cfg.Key(r)
+			if key == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := cfg.Store.Take(r.Context(), key, cfg.Limit, cfg.Period)
+			if err != nil {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(res.Reset))
+			if !res.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ceilSeconds returns d in seconds, rounded up.
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// KeyByIP identifies clients by remote IP address. Use a middleware that sets
+// the request RemoteAddr from a trusted proxy header when the server is behind
+// a proxy.
+func KeyByIP(r *http.Request) string {
+	return "ip:" + remoteIP(r)
+}
+
+// KeyBySubject identifies clients by the subject of their verified token, see
+// Authenticate, or by remote IP address for unauthenticated requests.
+func KeyBySubject(r *http.Request) string {
+	if c, ok := ClaimsFromContext(r.Context()); ok && c.Subject != "" {
+		return "sub:" + c.Subject
+	}
+	return KeyByIP(r)
+}
+
+// MemoryStoreOptions configures a MemoryStore.
+type MemoryStoreOptions struct {
+	// MaxKeys limits the number of buckets stored, evicting the least
+	// recently updated bucket when the limit is reached so clients can't
+	// reset their own bucket by making requests with other keys. Zero means
+	// no limit.
+	MaxKeys int
+	// SweepInterval is the minimum time between removals of the buckets
+	// that are full, which behave like missing buckets. Defaults to 1m.
+	SweepInterval time.Duration
+}
+
+// MemoryStore is a RateLimitStore that stores buckets in memory.
+type MemoryStore struct {
+	opts MemoryStoreOptions
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	// lru holds the buckets, least recently updated last.
+	lru       *list.List
+	lastSweep time.Time
+}
+
+var _ RateLimitStore = (*MemoryStore)(nil)
+
+// tokenBucket holds the tokens of a bucket at the time it was last updated.
+type tokenBucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+	limit   int
+	period  time.Duration
+}
+
+// refill adds the tokens earned since the last update at now.
+func (b *tokenBucket) refill(now time.Time) {
+	rate := float64(b.limit) / b.period.Seconds()
+	b.tokens = math.Min(float64(b.limit), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+}
+
+// full reports whether the bucket is full at now, without updating it.
+func (b *tokenBucket) full(now time.Time) bool {
+	rate := float64(b.limit) / b.period.Seconds()
+	return b.tokens+now.Sub(b.updated).Seconds()*rate >= float64(b.limit)
+}
+
+// NewMemoryStore returns a new MemoryStore.
+func NewMemoryStore(opts MemoryStoreOptions) *MemoryStore {
+	if opts.SweepInterval <= 0 {
+		opts.SweepInterval = defaultMemoryStoreSweepInterval
+	}
+
+	return &MemoryStore{
+		opts:      opts,
+		buckets:   map[string]*list.Element{},
+		lru:       list.New(),
+		lastSweep: time.Now(),
+	}
+}
+
+// Take implements RateLimitStore.
+func (s *MemoryStore) Take(ctx context.Context, key string, limit int, period time.Duration) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= s.opts.SweepInterval {
+		s.sweep(now)
+	}
+
+	var b *tokenBucket
+	if e, ok := s.buckets[key]; ok {
+		s.lru.MoveToFront(e)
+		b = e.Value.(*tokenBucket)
+	} else {
+		if s.opts.MaxKeys > 0 && len(s.buckets) >= s.opts.MaxKeys {
+			s.remove(s.lru.Back())
+		}
+		b = &tokenBucket{key: key, tokens: float64(limit), updated: now}
+		s.buckets[key] = s.lru.PushFront(b)
+	}
+	b.limit, b.period = limit, period
+	b.refill(now)
+
+	rate := float64(limit) / period.Seconds()
+	res := RateLimitResult{Limit: limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsDuration((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = secondsDuration((float64(limit) - b.tokens) / rate)
+
+	return res, nil
+}
+
+// sweep removes the buckets that are full at now.
+func (s *MemoryStore) sweep(now time.Time) {
+	for e := s.lru.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*tokenBucket).full(now) {
+			s.remove(e)
+		}
+		e = next
+	}
+	s.lastSweep = now
+}
+
+// remove removes the bucket of the list element e.
+func (s *MemoryStore) remove(e *list.Element) {
+	s.lru.Remove(e)
+	delete(s.buckets, e.Value.(*tokenBucket).key)
+}
+
+// Len returns the number of buckets stored.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.buckets)
+}
+
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,171 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"go.artefactual.dev/tools/middleware"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, int, time.Duration) (middleware.RateLimitResult, error) {
+	return middleware.RateLimitResult{}, errors.New("unavailable")
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	request := func(h http.Handler, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Limits requests per client IP", func(t *testing.T) {
+		t.Parallel()
+
+		h := middleware.RateLimit(middleware.RateLimitConfig{Limit: 2, Period: time.Hour})(ok)
+
+		w := request(h, "192.0.2.1:1234")
+		assert.Equal(t, w.Code, http.StatusOK)
+		assert.Equal(t, w.Header().Get("RateLimit-Limit"), "2")
+		assert.Equal(t, w.Header().Get("RateLimit-Remaining"), "1")
+		assert.Equal(t, w.Header().Get("RateLimit-Reset"), "1800")
+
+		w = request(h, "192.0.2.1:5678")
+		assert.Equal(t, w.Code, http.StatusOK)
+		assert.Equal(t, w.Header().Get("RateLimit-Remaining"), "0")
+
+		w = request(h, "192.0.2.1:1234")
+		assert.Equal(t, w.Code, http.StatusTooManyRequests)
+		assert.Equal(t, w.Header().Get("RateLimit-Remaining"), "0")
+		assert.Equal(t, w.Header().Get("RateLimit-Reset"), "3600")
+		assert.Equal(t, w.Header().Get("Retry-After"), "1800")
+
+		w = request(h, "192.0.2.2:1234")
+		assert.Equal(t, w.Code, http.StatusOK)
+	})
+
+	t.Run("Refills buckets over the period", func(t *testing.T) {
+		t.Parallel()
+
+		h := middleware.RateLimit(middleware.RateLimitConfig{Limit: 1, Period: 50 * time.Millisecond})(ok)
+
+		assert.Equal(t, request(h, "192.0.2.1:1234").Code, http.StatusOK)
+		w := request(h, "192.0.2.1:1234")
+		assert.Equal(t, w.Code, http.StatusTooManyRequests)
+		assert.Equal(t, w.Header().Get("Retry-After"), "1")
+
+		time.Sleep(60 * time.Millisecond)
+		assert.Equal(t, request(h, "192.0.2.1:1234").Code, http.StatusOK)
+	})
+
+	t.Run("Uses a custom key", func(t *testing.T) {
+		t.Parallel()
+
+		h := middleware.RateLimit(middleware.RateLimitConfig{
+			Limit:  1,
+			Period: time.Hour,
+			Key: func(r *http.Request) string {
+				return r.Header.Get("X-Api-Key")
+			},
+		})(ok)
+
+		for _, key := range []string{"a", "b", ""} {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-Api-Key", key)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			assert.Equal(t, w.Code, http.StatusOK)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Api-Key", "a")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		assert.Equal(t, w.Code, http.StatusTooManyRequests)
+	})
+
+	t.Run("Keys authenticated requests by subject", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		assert.Equal(t, middleware.KeyBySubject(req), "ip:192.0.2.1")
+
+		req = req.WithContext(middleware.WithClaims(req.Context(), &middleware.Claims{Subject: "user"}))
+		assert.Equal(t, middleware.KeyBySubject(req), "sub:user")
+	})
+
+	t.Run("Allows requests when the store fails", func(t *testing.T) {
+		t.Parallel()
+
+		h := middleware.RateLimit(middleware.RateLimitConfig{Store: failingStore{}})(ok)
+
+		w := request(h, "192.0.2.1:1234")
+		assert.Equal(t, w.Code, http.StatusOK)
+		assert.Equal(t, w.Header().Get("RateLimit-Limit"), "")
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Evicts buckets over the maximum number of keys", func(t *testing.T) {
+		t.Parallel()
+
+		s := middleware.NewMemoryStore(middleware.MemoryStoreOptions{MaxKeys: 2})
+		for _, key := range []string{"a", "b", "c"} {
+			_, err := s.Take(context.Background(), key, 10, time.Hour)
+			assert.NilError(t, err)
+		}
+		assert.Equal(t, s.Len(), 2)
+	})
+
+	t.Run("Keeps depleted buckets under eviction pressure", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		s := middleware.NewMemoryStore(middleware.MemoryStoreOptions{MaxKeys: 2})
+		res, err := s.Take(ctx, "a", 1, time.Hour)
+		assert.NilError(t, err)
+		assert.Equal(t, res.Allowed, true)
+
+		for i := range 10 {
+			_, err := s.Take(ctx, fmt.Sprintf("other-%d", i), 1, time.Hour)
+			assert.NilError(t, err)
+			res, err = s.Take(ctx, "a", 1, time.Hour)
+			assert.NilError(t, err)
+			assert.Equal(t, res.Allowed, false)
+		}
+		assert.Equal(t, s.Len(), 2)
+	})
+
+	t.Run("Sweeps full buckets", func(t *testing.T) {
+		t.Parallel()
+
+		s := middleware.NewMemoryStore(middleware.MemoryStoreOptions{SweepInterval: time.Millisecond})
+		_, err := s.Take(context.Background(), "a", 1, 10*time.Millisecond)
+		assert.NilError(t, err)
+		_, err = s.Take(context.Background(), "b", 1, time.Hour)
+		assert.NilError(t, err)
+		assert.Equal(t, s.Len(), 2)
+
+		time.Sleep(20 * time.Millisecond)
+		res, err := s.Take(context.Background(), "c", 1, time.Hour)
+		assert.NilError(t, err)
+		assert.Equal(t, res.Allowed, true)
+		assert.Equal(t, s.Len(), 2)
+	})
+}
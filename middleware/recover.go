@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"runtime"
@@ -10,10 +11,57 @@ import (
 	"github.com/go-logr/logr"
 )
 
-// Recover from panics and logs the error.
-func Recover(logger logr.Logger) func(http.Handler) http.Handler {
+type recoverOptions struct {
+	response func(w http.ResponseWriter, r *http.Request, rec any)
+	hook     func(r *http.Request, rec any, stack []byte)
+}
+
+// RecoverOption configures the Recover middleware.
+type RecoverOption interface {
+	apply(*recoverOptions)
+}
+
+type recoverResponseOption func(w http.ResponseWriter, r *http.Request, rec any)
+
+func (o recoverResponseOption) apply(opts *recoverOptions) {
+	opts.response = o
+}
+
+// WithRecoverResponse sets the function writing the response after a panic is
+// recovered, e.g. ProblemJSONResponse. It defaults to writing a 500 status code
+// without a body.
+func WithRecoverResponse(fn func(w http.ResponseWriter, r *http.Request, rec any)) RecoverOption {
+	return recoverResponseOption(fn)
+}
+
+type panicHookOption func(r *http.Request, rec any, stack []byte)
+
+func (o panicHookOption) apply(opts *recoverOptions) {
+	opts.hook = o
+}
+
+// WithPanicHook sets a function called with the value and the stack trace of
+// every recovered panic, e.g. to report it to an error tracker.
+func WithPanicHook(fn func(r *http.Request, rec any, stack []byte)) RecoverOption {
+	return panicHookOption(fn)
+}
+
+// Recover from panics and logs the error, with the request ID when RequestID is
+// applied before.
+//
+// If the handler panics after the response header is sent, the status already
+// sent is logged and, instead of writing a response, the connection is
+// aborted by panicking with http.ErrAbortHandler so the client can detect the
+// truncated response. Nothing is written to hijacked connections.
+func Recover(logger logr.Logger, opts ...RecoverOption) func(http.Handler) http.Handler {
+	o := recoverOptions{response: statusResponse}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := newResponseWriter(w)
 			defer func() {
 				if rec := recover(); rec != nil {
 					// Don't recover if the request is aborted, as this would
@@ -46,15 +94,62 @@ func Recover(logger logr.Logger) func(http.Handler) http.Handler {
 						b.WriteByte('\n')
 					}
 
+					logger := requestLogger(logger, r)
+					switch {
+					case rw.hijacked:
+						logger = logger.WithValues("hijacked", true)
+					case rw.Written():
+						logger = logger.WithValues("status", rw.Status())
+					}
 					logger.Error(errors.New(b.String()), "Panic error recovered.")
 
-					// Skip write header on upgrade connection.
-					if r.Header.Get("Connection") != "Upgrade" {
-						w.WriteHeader(http.StatusInternalServerError)
+					if o.hook != nil {
+						o.hook(r, rec, buf[:n])
+					}
+
+					switch {
+					case rw.hijacked:
+						// The handler owns the connection.
+					case rw.Written():
+						// The response can't be replaced, abort it.
+						panic(http.ErrAbortHandler)
+					case r.Header.Get("Connection") != "Upgrade":
+						// Skip write header on upgrade connection.
+						o.response(w, r, rec)
 					}
 				}
 			}()
-			h.ServeHTTP(w, r)
+			h.ServeHTTP(rw, r)
 		})
 	}
 }
+
+// statusResponse writes a 500 status code.
+func statusResponse(w http.ResponseWriter, r *http.Request, rec any) {
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+// problem is an RFC 9457 problem details object.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// ProblemJSONResponse writes a 500 response with an RFC 9457
+// "application/problem+json" body, including the request ID when RequestID is
+// applied before Recover. Use it with WithRecoverResponse.
+func ProblemJSONResponse(w http.ResponseWriter, r *http.Request, rec any) {
+	blob, _ := json.Marshal(problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(http.StatusInternalServerError),
+		Status:    http.StatusInternalServerError,
+		RequestID: RequestIDFromContext(r.Context()),
+	})
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(blob)
+}
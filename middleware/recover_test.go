@@ -1,10 +1,15 @@
 package middleware_test
 
 import (
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/go-logr/logr"
 	"github.com/go-logr/logr/funcr"
 	"gotest.tools/v3/assert"
 	"gotest.tools/v3/assert/cmp"
@@ -32,3 +37,184 @@ func TestRescoverMiddleware(t *testing.T) {
 	assert.Assert(t, cmp.Contains(logged, "\"msg\"=\"Panic error recovered.\""))
 	assert.Assert(t, cmp.Contains(logged, "\"error\"=\"panic: opsie"))
 }
+
+func TestRecoverOptions(t *testing.T) {
+	t.Parallel()
+
+	panicker := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) { panic("opsie") })
+
+	t.Run("Writes a problem+json response with the request ID", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+		req.Header.Set(middleware.RequestIDHeader, "abc")
+		w := httptest.NewRecorder()
+
+		mw := middleware.Recover(logr.Discard(), middleware.WithRecoverResponse(middleware.ProblemJSONResponse))
+		middleware.RequestID("")(mw(panicker)).ServeHTTP(w, req)
+
+		assert.Equal(t, w.Code, http.StatusInternalServerError)
+		assert.Equal(t, w.Header().Get("Content-Type"), "application/problem+json")
+		assert.Equal(t, w.Body.String(), `{"type":"about:blank","title":"Internal Server Error","status":500,"requestId":"abc"}`)
+	})
+
+	t.Run("Calls the panic hook", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+		w := httptest.NewRecorder()
+
+		var (
+			gotRec   any
+			gotStack string
+		)
+		mw := middleware.Recover(logr.Discard(), middleware.WithPanicHook(func(r *http.Request, rec any, stack []byte) {
+			gotRec, gotStack = rec, string(stack)
+		}))
+		mw(panicker).ServeHTTP(w, req)
+
+		assert.Equal(t, w.Code, http.StatusInternalServerError)
+		assert.Equal(t, gotRec, "opsie")
+		assert.Assert(t, cmp.Contains(gotStack, "goroutine "))
+	})
+
+	t.Run("Skips the response on upgrade connections", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+		req.Header.Set("Connection", "Upgrade")
+		w := httptest.NewRecorder()
+
+		called := false
+		mw := middleware.Recover(logr.Discard(), middleware.WithRecoverResponse(func(w http.ResponseWriter, r *http.Request, rec any) {
+			called = true
+		}))
+		mw(panicker).ServeHTTP(w, req)
+
+		assert.Equal(t, called, false)
+	})
+
+	t.Run("Doesn't recover aborted requests", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+		w := httptest.NewRecorder()
+
+		hooked := false
+		mw := middleware.Recover(logr.Discard(), middleware.WithPanicHook(func(r *http.Request, rec any, stack []byte) {
+			hooked = true
+		}))
+		h := mw(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) { panic(http.ErrAbortHandler) }))
+
+		defer func() {
+			assert.Equal(t, recover(), http.ErrAbortHandler)
+			assert.Equal(t, hooked, false)
+		}()
+		h.ServeHTTP(w, req)
+	})
+}
+
+func TestRecoverWrittenResponses(t *testing.T) {
+	t.Parallel()
+
+	// newServer returns a test server for h wrapped with Recover, the lines
+	// logged by Recover and the server error log.
+	newServer := func(t *testing.T, h http.HandlerFunc) (*httptest.Server, func() []string, *strings.Builder) {
+		logger, logged := newTestLogger(0)
+		ts := httptest.NewUnstartedServer(middleware.Recover(logger)(h))
+		errorLog := &strings.Builder{}
+		ts.Config.ErrorLog = log.New(&syncWriter{w: errorLog}, "", 0)
+		ts.Start()
+		t.Cleanup(ts.Close)
+
+		return ts, logged, errorLog
+	}
+
+	t.Run("Aborts streaming responses", func(t *testing.T) {
+		t.Parallel()
+
+		ts, logged, errorLog := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			panic("opsie")
+		})
+
+		resp, err := ts.Client().Get(ts.URL)
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, resp.StatusCode, http.StatusAccepted)
+
+		_, err = io.ReadAll(resp.Body)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+		lines := logged()
+		assert.Equal(t, len(lines), 1)
+		assert.Assert(t, cmp.Contains(lines[0], `"status"=202`))
+		ts.Close()
+		assert.Assert(t, !strings.Contains(errorLog.String(), "superfluous"), errorLog.String())
+	})
+
+	t.Run("Records responses written with ReadFrom", func(t *testing.T) {
+		t.Parallel()
+
+		ts, logged, _ := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			rf, ok := w.(io.ReaderFrom)
+			if !ok {
+				panic("not an io.ReaderFrom")
+			}
+			rf.ReadFrom(strings.NewReader("partial"))
+			w.(http.Flusher).Flush()
+			panic("opsie")
+		})
+
+		resp, err := ts.Client().Get(ts.URL)
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, resp.StatusCode, http.StatusOK)
+
+		lines := logged()
+		assert.Equal(t, len(lines), 1)
+		assert.Assert(t, cmp.Contains(lines[0], `"status"=200`))
+	})
+
+	t.Run("Leaves hijacked connections alone", func(t *testing.T) {
+		t.Parallel()
+
+		ts, logged, errorLog := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			conn, bufrw, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				panic(err)
+			}
+			defer conn.Close()
+			bufrw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+			bufrw.Flush()
+			panic("opsie")
+		})
+
+		resp, err := ts.Client().Get(ts.URL)
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.NilError(t, err)
+		assert.Equal(t, string(body), "ok")
+
+		lines := logged()
+		assert.Equal(t, len(lines), 1)
+		assert.Assert(t, cmp.Contains(lines[0], `"hijacked"=true`))
+		ts.Close()
+		assert.Equal(t, errorLog.String(), "")
+	})
+}
+
+// syncWriter serializes writes to w.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
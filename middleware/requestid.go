@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is the default header used to propagate request IDs.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLen is the maximum length of inbound request IDs.
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// RequestID sets a request ID on every request. It uses the ID found in the
+// request header, as set by a client or a proxy, if it's valid, i.e. up to
+// 128 letters, digits and "-", "_", ".", ":" or "=" characters. Otherwise, it
+// generates a UUIDv7. If header is empty, it defaults to RequestIDHeader.
+//
+// The ID is set on the response header and stored in the request context, see
+// RequestIDFromContext. A logger found in the context, see logr.FromContext,
+// is replaced with one that logs the ID. Recover and AccessLog also log the ID
+// when RequestID is applied before them.
+func RequestID(header string) func(http.Handler) http.Handler {
+	if header == "" {
+		header = RequestIDHeader
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+
+			w.Header().Set(header, id)
+			ctx := WithRequestID(r.Context(), id)
+			if logger, err := logr.FromContext(ctx); err == nil {
+				ctx = logr.NewContext(ctx, logger.WithValues("requestID", id))
+			}
+
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// WithRequestID returns a copy of ctx holding the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, or an empty
+// string if there's none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether id is an acceptable inbound request ID, which
+// excludes characters that could be used to forge log entries.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a UUIDv7, which sorts by creation time.
+func newRequestID() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		// Only fails if the random source does, use a random UUID.
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+// requestLogger returns logger with the request ID of r, if any.
+func requestLogger(logger logr.Logger, r *http.Request) logr.Logger {
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		return logger.WithValues("requestID", id)
+	}
+	return logger
+}
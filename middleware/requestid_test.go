@@ -0,0 +1,102 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+
+	"go.artefactual.dev/tools/middleware"
+)
+
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+
+	// echo writes the request ID found in the context.
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(middleware.RequestIDFromContext(r.Context())))
+	})
+
+	type test struct {
+		name    string
+		header  string
+		inbound string
+		keep    bool
+	}
+	for _, tc := range []test{
+		{name: "Generates a request ID", header: ""},
+		{name: "Keeps a valid inbound request ID", inbound: "req-42_a.b:c=", keep: true},
+		{name: "Replaces an invalid inbound request ID", inbound: "forged\nlog entry"},
+		{name: "Replaces a long inbound request ID", inbound: strings.Repeat("a", 129)},
+		{name: "Uses a custom header", header: "X-Correlation-Id", inbound: "abc", keep: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			header := tc.header
+			if header == "" {
+				header = middleware.RequestIDHeader
+			}
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.inbound != "" {
+				req.Header.Set(header, tc.inbound)
+			}
+			rec := httptest.NewRecorder()
+
+			middleware.RequestID(tc.header)(echo).ServeHTTP(rec, req)
+
+			id := rec.Header().Get(header)
+			assert.Equal(t, rec.Body.String(), id)
+			if tc.keep {
+				assert.Equal(t, id, tc.inbound)
+				return
+			}
+			u, err := uuid.Parse(id)
+			assert.NilError(t, err)
+			assert.Equal(t, u.Version(), uuid.Version(7))
+		})
+	}
+
+	t.Run("Adds the request ID to the context logger", func(t *testing.T) {
+		t.Parallel()
+
+		logger, logged := newTestLogger(0)
+		h := middleware.RequestID("")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logr.FromContextOrDiscard(r.Context()).Info("Handling.")
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(middleware.RequestIDHeader, "abc")
+		h.ServeHTTP(httptest.NewRecorder(), req.WithContext(logr.NewContext(req.Context(), logger)))
+
+		assert.DeepEqual(t, logged(), []string{`"level"=0 "msg"="Handling." "requestID"="abc"`})
+	})
+
+	t.Run("Adds the request ID to Recover and AccessLog logs", func(t *testing.T) {
+		t.Parallel()
+
+		logger, logged := newTestLogger(0)
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("opsie") })
+		mw := middleware.RequestID("")(
+			middleware.AccessLog(logger, middleware.AccessLogConfig{})(
+				middleware.Recover(logger)(h),
+			),
+		)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(middleware.RequestIDHeader, "abc")
+		mw.ServeHTTP(httptest.NewRecorder(), req)
+
+		lines := logged()
+		assert.Equal(t, len(lines), 2)
+		assert.Assert(t, cmp.Contains(lines[0], `"msg"="Panic error recovered."`))
+		assert.Assert(t, cmp.Contains(lines[0], `"requestID"="abc"`))
+		assert.Assert(t, cmp.Contains(lines[1], `"requestID"="abc"`))
+		assert.Assert(t, cmp.Contains(lines[1], `"status"=500`))
+	})
+}
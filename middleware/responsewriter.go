@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// responseWriter wraps an http.ResponseWriter to record the response status
+// code and size.
+type responseWriter struct {
+	http.ResponseWriter
+
+	status   int
+	bytes    int64
+	hijacked bool
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w}
+}
+
+// Status returns the response status code, http.StatusOK if the handler wrote
+// a body without writing a header, or zero if nothing was written.
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+// Written reports whether the response header has been written.
+func (w *responseWriter) Written() bool {
+	return w.status != 0 || w.hijacked
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	// Informational responses can be followed by another header.
+	if w.status == 0 && (code < 100 || code > 199 || code == http.StatusSwitchingProtocols) {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom so io.Copy and http.ServeContent can use
+// the wrapped writer's, e.g. to send files with sendfile(2).
+func (w *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := io.Copy(w.ResponseWriter, r)
+	w.bytes += n
+	return n, err
+}
+
+// Flush implements http.Flusher for handlers that use a type assertion instead
+// of http.ResponseController.
+func (w *responseWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack implements http.Hijacker for handlers that use a type assertion
+// instead of http.ResponseController.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
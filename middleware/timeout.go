@@ -1,7 +1,11 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -36,3 +40,147 @@ func ReadTimeout(timeout time.Duration) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// TimeoutConfig configures the Timeout middleware.
+type TimeoutConfig struct {
+	// Timeout is the time allowed to handle a request. Zero means no timeout.
+	Timeout time.Duration
+	// Routes overrides Timeout for the given route templates, e.g.
+	// "/uploads/{id}", or http.ServeMux patterns.
+	Routes map[string]time.Duration
+	// Status is the status code of the response sent when a request times
+	// out, e.g. http.StatusGatewayTimeout. Defaults to 503 Service
+	// Unavailable.
+	Status int
+	// Body is the body of the response sent when a request times out.
+	// Defaults to the status text.
+	Body string
+	// ContentType is the content type of Body. Defaults to
+	// "text/plain; charset=utf-8".
+	ContentType string
+}
+
+// Timeout runs the handler with a request context that is canceled after the
+// timeout of the request route, see TimeoutConfig. If the handler hasn't
+// returned by then, the client gets the timeout response and later writes to
+// the http.ResponseWriter return http.ErrHandlerTimeout.
+//
+// Unlike WriteTimeout and ReadTimeout, handlers are expected to return once
+// the context is done and clients get a response instead of a dropped
+// connection. Like with http.TimeoutHandler, responses are buffered until the
+// handler returns so the timeout response is never mixed with a partial one;
+// flushing and hijacking aren't supported.
+//
+// Route overrides apply when Timeout is used as a gorilla/mux middleware, or
+// wraps the handler of a single route.
+func Timeout(cfg TimeoutConfig) func(http.Handler) http.Handler {
+	if cfg.Status == 0 {
+		cfg.Status = http.StatusServiceUnavailable
+	}
+	if cfg.Body == "" {
+		cfg.Body = http.StatusText(cfg.Status)
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = "text/plain; charset=utf-8"
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := cfg.Timeout
+			if d, ok := cfg.Routes[routeTemplate(r)]; ok {
+				timeout = d
+			}
+			if timeout <= 0 {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{w: w, h: make(http.Header)}
+			done := make(chan struct{})
+			panicChan := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicChan <- p
+					}
+				}()
+				h.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicChan:
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				dst := w.Header()
+				for k, vv := range tw.h {
+					dst[k] = vv
+				}
+				if tw.code == 0 {
+					tw.code = http.StatusOK
+				}
+				w.WriteHeader(tw.code)
+				_, _ = w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					w.Header().Set("Content-Type", cfg.ContentType)
+					w.Header().Set("X-Content-Type-Options", "nosniff")
+					w.WriteHeader(cfg.Status)
+					_, _ = w.Write([]byte(cfg.Body))
+					tw.err = http.ErrHandlerTimeout
+				} else {
+					// The client went away.
+					w.WriteHeader(http.StatusServiceUnavailable)
+					tw.err = ctx.Err()
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers the response of a handler run by Timeout.
+type timeoutWriter struct {
+	w    http.ResponseWriter
+	h    http.Header
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	code int
+	err  error
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.err != nil {
+		return 0, tw.err
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.err != nil || tw.code != 0 || (code >= 100 && code <= 199) {
+		return
+	}
+	tw.code = code
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
 	"gotest.tools/v3/assert"
 
 	"go.artefactual.dev/tools/middleware"
@@ -91,3 +92,112 @@ func TestReadTimeout(t *testing.T) {
 		})
 	}
 }
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+
+	// slow waits for the request context to be done, then for release to be
+	// closed before writing.
+	slow := func(release <-chan struct{}, writeErr chan<- error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			<-release
+			_, err := w.Write([]byte("late"))
+			writeErr <- err
+		}
+	}
+
+	t.Run("Writes the response of a handler within the timeout", func(t *testing.T) {
+		t.Parallel()
+
+		h := middleware.Timeout(middleware.TimeoutConfig{Timeout: time.Minute})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, ok := r.Context().Deadline()
+				assert.Assert(t, ok)
+				w.Header().Set("X-Test", "yes")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("Hi there!"))
+			}),
+		)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		assert.Equal(t, w.Code, http.StatusCreated)
+		assert.Equal(t, w.Header().Get("X-Test"), "yes")
+		assert.Equal(t, w.Body.String(), "Hi there!")
+	})
+
+	t.Run("Writes the timeout response when the handler overruns", func(t *testing.T) {
+		t.Parallel()
+
+		release := make(chan struct{})
+		writeErr := make(chan error, 1)
+		h := middleware.Timeout(middleware.TimeoutConfig{
+			Timeout:     time.Millisecond,
+			Status:      http.StatusGatewayTimeout,
+			Body:        `{"error":"timeout"}`,
+			ContentType: "application/json",
+		})(slow(release, writeErr))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		close(release)
+
+		assert.Equal(t, w.Code, http.StatusGatewayTimeout)
+		assert.Equal(t, w.Header().Get("Content-Type"), "application/json")
+		assert.Equal(t, w.Body.String(), `{"error":"timeout"}`)
+		assert.ErrorIs(t, <-writeErr, http.ErrHandlerTimeout)
+	})
+
+	t.Run("Defaults to 503 Service Unavailable", func(t *testing.T) {
+		t.Parallel()
+
+		release := make(chan struct{})
+		writeErr := make(chan error, 1)
+		h := middleware.Timeout(middleware.TimeoutConfig{Timeout: time.Millisecond})(slow(release, writeErr))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		close(release)
+
+		assert.Equal(t, w.Code, http.StatusServiceUnavailable)
+		assert.Equal(t, w.Body.String(), "Service Unavailable")
+		<-writeErr
+	})
+
+	t.Run("Overrides the timeout per route", func(t *testing.T) {
+		t.Parallel()
+
+		router := mux.NewRouter()
+		router.Use(middleware.Timeout(middleware.TimeoutConfig{
+			Timeout: time.Millisecond,
+			Routes:  map[string]time.Duration{"/uploads/{id}": 0},
+		}))
+		router.HandleFunc("/uploads/{id}", func(w http.ResponseWriter, r *http.Request) {
+			_, ok := r.Context().Deadline()
+			assert.Assert(t, !ok)
+			time.Sleep(5 * time.Millisecond)
+			w.Write([]byte("uploaded"))
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PUT", "/uploads/1", nil))
+
+		assert.Equal(t, w.Code, http.StatusOK)
+		assert.Equal(t, w.Body.String(), "uploaded")
+	})
+
+	t.Run("Propagates handler panics", func(t *testing.T) {
+		t.Parallel()
+
+		h := middleware.Timeout(middleware.TimeoutConfig{Timeout: time.Minute})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("opsie") }),
+		)
+
+		defer func() {
+			assert.Equal(t, recover(), "opsie")
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+}